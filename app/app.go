@@ -0,0 +1,293 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cloudneedle/gokit/log"
+)
+
+// Runnable 可由App管理的组件,如 web.Server、queue.Worker
+//
+// Start应在组件启动完成后返回,不应阻塞直到组件退出;阻塞运行的函数可以用Func包装
+type Runnable interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// errorer 运行中出错时通过Err()通知的组件,如 web.Server
+type errorer interface {
+	Err() <-chan error
+}
+
+type component struct {
+	name      string
+	r         Runnable
+	dependsOn []string
+}
+
+// Option App选项
+type Option func(*App)
+
+// WithName 设置服务名称,日志中以 srv_name 字段输出
+func WithName(name string) Option {
+	return func(a *App) {
+		a.name = name
+	}
+}
+
+// WithLogger 设置日志,默认 log.New()
+func WithLogger(l *log.Logger) Option {
+	return func(a *App) {
+		a.logger = l
+	}
+}
+
+// WithStopTimeout 设置停止所有组件的超时时间,默认30秒
+func WithStopTimeout(d time.Duration) Option {
+	return func(a *App) {
+		a.stopTimeout = d
+	}
+}
+
+// WithSignals 设置触发停止的信号,默认SIGINT与SIGTERM
+func WithSignals(sigs ...os.Signal) Option {
+	return func(a *App) {
+		a.signals = sigs
+	}
+}
+
+// App 组合多个组件统一启动和停止
+//
+// 按依赖顺序启动,任一组件启动失败或运行中出错时停止其余组件;
+// 收到信号后按启动的逆序停止
+//
+// example:
+//
+//	a := app.New(app.WithName("order"))
+//	a.Add("redis", redisComponent)
+//	a.Add("queue", worker, "redis")
+//	a.Add("http", server, "redis", "queue")
+//	if err := a.Run(context.Background()); err != nil {
+//	  a.Logger().Fatal(err)
+//	}
+type App struct {
+	name        string
+	logger      *log.Logger
+	stopTimeout time.Duration
+	signals     []os.Signal
+	components  []component
+}
+
+// New 创建App
+func New(opts ...Option) *App {
+	a := &App{
+		stopTimeout: 30 * time.Second,
+		signals:     []os.Signal{os.Interrupt, syscall.SIGTERM},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.logger == nil {
+		a.logger = log.New()
+	}
+	if a.name != "" {
+		a.logger.AddHook(log.NewAppHook(a.name))
+	}
+	return a
+}
+
+// Name 服务名称
+func (a *App) Name() string {
+	return a.name
+}
+
+// Logger 带有服务名称的日志
+func (a *App) Logger() *log.Logger {
+	return a.logger
+}
+
+// Add 添加组件,dependsOn中的组件会先于当前组件启动、后于当前组件停止
+func (a *App) Add(name string, r Runnable, dependsOn ...string) *App {
+	a.components = append(a.components, component{name: name, r: r, dependsOn: dependsOn})
+	return a
+}
+
+// Run 启动所有组件并阻塞,直到收到信号、ctx取消或组件出错,然后停止所有组件
+//
+// 返回第一个导致退出的错误,因信号或ctx取消正常退出时返回停止过程中的第一个错误
+func (a *App) Run(ctx context.Context) error {
+	order, err := a.order()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(ctx, a.signals...)
+	defer stop()
+
+	failed := make(chan error, len(order))
+	started := make([]component, 0, len(order))
+	var first error
+	for _, c := range order {
+		a.logger.Infof("starting %s", c.name)
+		if err = c.r.Start(ctx); err != nil {
+			first = fmt.Errorf("app: start %s: %w", c.name, err)
+			break
+		}
+		started = append(started, c)
+		if e, ok := c.r.(errorer); ok {
+			go watch(ctx, c.name, e, failed)
+		}
+	}
+
+	if first == nil {
+		a.logger.Infof("started %d components", len(started))
+		select {
+		case <-ctx.Done():
+			a.logger.Info("stopping")
+		case first = <-failed:
+			a.logger.Errorf("stopping: %v", first)
+		}
+	} else {
+		a.logger.Errorf("stopping: %v", first)
+	}
+	stop()
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), a.stopTimeout)
+	defer cancel()
+	for i := len(started) - 1; i >= 0; i-- {
+		c := started[i]
+		a.logger.Infof("stopping %s", c.name)
+		if err := c.r.Stop(stopCtx); err != nil {
+			err = fmt.Errorf("app: stop %s: %w", c.name, err)
+			a.logger.Error(err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// watch 转发组件运行中的错误
+func watch(ctx context.Context, name string, e errorer, failed chan<- error) {
+	select {
+	case <-ctx.Done():
+	case err, ok := <-e.Err():
+		if ok && err != nil {
+			failed <- fmt.Errorf("app: %s: %w", name, err)
+		}
+	}
+}
+
+// order 按依赖关系排序,没有依赖关系的组件保持添加的顺序
+func (a *App) order() ([]component, error) {
+	index := make(map[string]int, len(a.components))
+	for i, c := range a.components {
+		if _, ok := index[c.name]; ok {
+			return nil, fmt.Errorf("app: duplicate component %s", c.name)
+		}
+		index[c.name] = i
+	}
+	for _, c := range a.components {
+		for _, dep := range c.dependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("app: %s depends on unknown component %s", c.name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(a.components))
+	order := make([]component, 0, len(a.components))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("app: dependency cycle at %s", a.components[i].name)
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, dep := range a.components[i].dependsOn {
+			if err := visit(index[dep]); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		order = append(order, a.components[i])
+		return nil
+	}
+	for i := range a.components {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Func 将阻塞运行的函数包装为Runnable,Stop时取消ctx并等待函数返回
+//
+// example:
+//
+//	a.Add("config-watcher", app.Func(func(ctx context.Context) error {
+//	  return cli.Etcd.WatchPrefixContext(ctx, "app/", onChange)
+//	}))
+func Func(run func(ctx context.Context) error) Runnable {
+	return &funcRunnable{run: run}
+}
+
+type funcRunnable struct {
+	run    func(ctx context.Context) error
+	cancel context.CancelFunc
+	done   chan struct{}
+	errc   chan error
+}
+
+func (f *funcRunnable) Start(context.Context) error {
+	if f.done != nil {
+		return errors.New("app: already started")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	f.done = make(chan struct{})
+	f.errc = make(chan error, 1)
+	go func() {
+		defer close(f.done)
+		err := f.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		// 未被停止就返回视为出错
+		if err == nil {
+			err = errors.New("exited")
+		}
+		f.errc <- err
+	}()
+	return nil
+}
+
+func (f *funcRunnable) Stop(ctx context.Context) error {
+	if f.cancel == nil {
+		return nil
+	}
+	f.cancel()
+	select {
+	case <-f.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *funcRunnable) Err() <-chan error {
+	return f.errc
+}
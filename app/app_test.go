@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudneedle/gokit/queue"
+	"github.com/cloudneedle/gokit/web"
+)
+
+var (
+	_ Runnable = (*web.Server)(nil)
+	_ Runnable = (*queue.Worker[string])(nil)
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(e string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.events, ",")
+}
+
+type fake struct {
+	name     string
+	rec      *recorder
+	startErr error
+}
+
+func (f *fake) Start(context.Context) error {
+	if f.startErr != nil {
+		return f.startErr
+	}
+	f.rec.add("start " + f.name)
+	return nil
+}
+
+func (f *fake) Stop(context.Context) error {
+	f.rec.add("stop " + f.name)
+	return nil
+}
+
+func TestApp_Order(t *testing.T) {
+	rec := &recorder{}
+	a := New(WithName("test"))
+	a.Add("http", &fake{name: "http", rec: rec}, "redis", "queue")
+	a.Add("queue", &fake{name: "queue", rec: rec}, "redis")
+	a.Add("redis", &fake{name: "redis", rec: rec})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := a.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := "start redis,start queue,start http,stop http,stop queue,stop redis"
+	if rec.String() != want {
+		t.Fatalf("events = %s", rec)
+	}
+
+	a = New()
+	a.Add("a", &fake{}, "b")
+	a.Add("b", &fake{}, "a")
+	if err := a.Run(context.Background()); err == nil {
+		t.Fatal("cycle should fail")
+	}
+}
+
+func TestApp_Failure(t *testing.T) {
+	rec := &recorder{}
+	boom := errors.New("boom")
+
+	a := New()
+	a.Add("redis", &fake{name: "redis", rec: rec})
+	a.Add("http", &fake{name: "http", rec: rec, startErr: boom})
+	if err := a.Run(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("err = %v", err)
+	}
+	if rec.String() != "start redis,stop redis" {
+		t.Fatalf("events = %s", rec)
+	}
+
+	rec = &recorder{}
+	a = New()
+	a.Add("redis", &fake{name: "redis", rec: rec})
+	a.Add("watcher", Func(func(ctx context.Context) error {
+		return boom
+	}))
+	if err := a.Run(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("err = %v", err)
+	}
+	if rec.String() != "start redis,stop redis" {
+		t.Fatalf("events = %s", rec)
+	}
+}
@@ -0,0 +1,229 @@
+// gokit-config 配置管理工具,基于config.Client读写ETCD或YAML配置
+//
+// usage:
+//
+//	gokit-config [-type etcd|yaml] [-path 127.0.0.1:2379] <command> [args]
+//
+//	get <key>                          获取配置
+//	put [-secret] <key> <value>        设置配置,-secret 加密后写入
+//	delete <key>                       删除配置
+//	list <prefix>                      列出前缀下的配置
+//	watch <prefix>                     监听前缀下的变化
+//	export [-format yaml|json] [-o file] [-reveal] <prefix>
+//	                                   导出前缀下的配置,文件中的key相对于前缀,-reveal 导出解密后的值
+//	import [-prefix p] [-from p] [-prune] [-dry-run] <file>
+//	                                   从YAML或JSON文件导入配置,导入到其他前缀时 -from 指定导出时的前缀,
+//	                                   加密值使用密钥环重新加密
+//	diff [-prefix p] <file>            对比文件与当前配置
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cloudneedle/gokit/config"
+)
+
+func main() {
+	var (
+		typ     = flag.String("type", "etcd", "配置类型: etcd、yaml")
+		path    = flag.String("path", "127.0.0.1:2379", "ETCD地址,多个用逗号分隔;或YAML文件路径")
+		keyring = flag.String("keyring", "", "密钥文件路径,为空时读取环境变量"+config.KeyringEnv)
+		timeout = flag.Duration("timeout", 3*time.Second, "ETCD请求超时时间")
+	)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cli, err := newClient(*typ, *path, *keyring, *timeout)
+	if err != nil {
+		fatal(err)
+	}
+	defer cli.Close()
+
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	switch cmd {
+	case "get":
+		err = runGet(cli, args)
+	case "put":
+		err = runPut(cli, args)
+	case "delete", "del":
+		err = runDelete(cli, args)
+	case "list", "ls":
+		err = runList(cli, args)
+	case "watch":
+		err = runWatch(cli, args)
+	case "export":
+		err = runExport(cli, args)
+	case "import":
+		err = runImport(cli, args)
+	case "diff":
+		err = runDiff(cli, args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, `usage: gokit-config [flags] <command> [args]
+
+commands:
+  get <key>                                      获取配置
+  put [-secret] <key> <value>                    设置配置
+  delete <key>                                   删除配置
+  list <prefix>                                  列出前缀下的配置
+  watch <prefix>                                 监听前缀下的变化
+  export [-format yaml|json] [-o file] [-reveal] <prefix>
+                                                 导出前缀下的配置
+  import [-prefix p] [-from p] [-prune] [-dry-run] <file>
+                                                 从YAML或JSON文件导入配置
+  diff [-prefix p] <file>                        对比文件与当前配置
+
+flags:`)
+	flag.PrintDefaults()
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "gokit-config:", err)
+	os.Exit(1)
+}
+
+// newClient 创建配置客户端,存在密钥时启用加密值读写
+func newClient(typ, path, keyfile string, timeout time.Duration) (*config.Client, error) {
+	opts := []config.ClientOption{config.WithPath(path), config.WithTimeout(timeout)}
+	switch typ {
+	case "etcd":
+		opts = append(opts, config.WithType(config.ETCD))
+	case "yaml":
+		opts = append(opts, config.WithType(config.YAML))
+	default:
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+
+	var (
+		ring *config.Keyring
+		err  error
+	)
+	if keyfile != "" {
+		ring, err = config.LoadKeyring(keyfile)
+	} else if os.Getenv(config.KeyringEnv) != "" {
+		ring, err = config.LoadKeyringEnv("")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ring != nil {
+		opts = append(opts, config.WithKeyring(ring))
+	}
+	return config.New(opts...)
+}
+
+// parseArgs 解析子命令参数,检查位置参数数量
+func parseArgs(fs *flag.FlagSet, args []string, n int, usage string) ([]string, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gokit-config %s %s\n", fs.Name(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != n {
+		fs.Usage()
+		return nil, errors.New("wrong number of arguments")
+	}
+	return fs.Args(), nil
+}
+
+func runGet(cli *config.Client, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	args, err := parseArgs(fs, args, 1, "<key>")
+	if err != nil {
+		return err
+	}
+	v, err := cli.Get(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(v)
+	return nil
+}
+
+func runPut(cli *config.Client, args []string) error {
+	fs := flag.NewFlagSet("put", flag.ExitOnError)
+	secret := fs.Bool("secret", false, "加密后写入")
+	args, err := parseArgs(fs, args, 2, "[-secret] <key> <value>")
+	if err != nil {
+		return err
+	}
+	if *secret {
+		return cli.PutSecret(args[0], args[1])
+	}
+	return cli.Put(args[0], args[1])
+}
+
+func runDelete(cli *config.Client, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	args, err := parseArgs(fs, args, 1, "<key>")
+	if err != nil {
+		return err
+	}
+	return cli.Delete(args[0])
+}
+
+func runList(cli *config.Client, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	args, err := parseArgs(fs, args, 1, "<prefix>")
+	if err != nil {
+		return err
+	}
+	kvs, err := cli.GetPrefix(args[0])
+	if err != nil {
+		return err
+	}
+	for _, k := range sortedKeys(kvs) {
+		fmt.Printf("%s=%s\n", k, kvs[k])
+	}
+	return nil
+}
+
+func runWatch(cli *config.Client, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	args, err := parseArgs(fs, args, 1, "<prefix>")
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// ETCD可以区分删除与空值
+	if cli.Etcd != nil {
+		return cli.Etcd.WatchPrefixContext(ctx, args[0], func(evs []config.Event) {
+			for _, ev := range evs {
+				fmt.Printf("%s %s=%s (rev %d)\n", ev.Type, ev.Key, ev.Value, ev.Revision)
+			}
+		})
+	}
+	go func() {
+		<-ctx.Done()
+		cli.Close()
+	}()
+	return cli.WatchPrefix(args[0], func(m map[string]string) {
+		for _, k := range sortedKeys(m) {
+			fmt.Printf("%s=%s\n", k, m[k])
+		}
+	})
+}
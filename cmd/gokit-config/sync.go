@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cloudneedle/gokit/config"
+	"gopkg.in/yaml.v3"
+)
+
+func runExport(cli *config.Client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "yaml", "导出格式: yaml、json")
+	out := fs.String("o", "", "输出文件,为空时输出到标准输出")
+	reveal := fs.Bool("reveal", false, "导出解密后的加密值,默认保持加密")
+	args, err := parseArgs(fs, args, 1, "[-format yaml|json] [-o file] [-reveal] <prefix>")
+	if err != nil {
+		return err
+	}
+
+	// 文件中的key相对于前缀,以便 import -prefix 导入到相同或其他前缀;
+	// 加密值绑定导出时的key,导入到其他前缀时通过 -from 指定导出时的前缀以重新加密
+	prefix := strings.Trim(args[0], "/")
+	query := prefix
+	if query != "" {
+		query += "/"
+	}
+	var kvs map[string]string
+	if *reveal {
+		kvs, err = cli.GetPrefix(query)
+	} else {
+		kvs, err = cli.Provider().GetPrefix(query)
+	}
+	if err != nil {
+		return err
+	}
+	kvs = relativeKeys(kvs, prefix)
+
+	var b []byte
+	switch *format {
+	case "yaml":
+		b, err = yaml.Marshal(config.Expand(kvs))
+	case "json":
+		b, err = json.MarshalIndent(config.Expand(kvs), "", "  ")
+		b = append(b, '\n')
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(*out, b, 0644)
+}
+
+func runImport(cli *config.Client, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "导入到该前缀下")
+	from := fs.String("from", "", "文件导出时的前缀,与-prefix不同时重新加密加密值,默认与-prefix相同")
+	prune := fs.Bool("prune", false, "删除前缀下文件中不存在的配置,需要指定-prefix")
+	dryRun := fs.Bool("dry-run", false, "只打印变更,不写入")
+	args, err := parseArgs(fs, args, 1, "[-prefix p] [-from p] [-prune] [-dry-run] <file>")
+	if err != nil {
+		return err
+	}
+	if *prune && *prefix == "" {
+		return fmt.Errorf("-prune requires -prefix")
+	}
+	if !isFlagSet(fs, "from") {
+		*from = *prefix
+	}
+
+	changes, err := diffFile(cli, args[0], *prefix)
+	if err != nil {
+		return err
+	}
+	var ops []config.Op
+	for _, c := range changes {
+		switch {
+		case c.file != nil:
+			v, err := resealValue(cli, c.key, *c.file, *prefix, *from)
+			if err != nil {
+				return err
+			}
+			ops = append(ops, config.PutOp(c.key, v))
+		case *prune:
+			ops = append(ops, config.DeleteOp(c.key))
+		default:
+			continue
+		}
+		printChange(c)
+	}
+	if len(ops) == 0 {
+		fmt.Println("no changes")
+		return nil
+	}
+	if *dryRun {
+		fmt.Printf("dry run: %d change(s) not applied\n", len(ops))
+		return nil
+	}
+	// 分批写入以满足ETCD单个事务的操作数限制,每批全部成功或全部失败
+	applied := 0
+	for _, batch := range chunkOps(ops, maxTxnOps) {
+		if err = cli.Txn(context.Background(), nil, batch...); err != nil {
+			return fmt.Errorf("applied %d of %d change(s): %w", applied, len(ops), err)
+		}
+		applied += len(batch)
+	}
+	fmt.Printf("applied %d change(s)\n", applied)
+	return nil
+}
+
+// resealValue 加密值绑定key,导入到与导出时不同的key下需要重新加密
+//
+// 设置了密钥环时总是重新加密,同时校验密文能以导出时的key解密;
+// 未设置密钥环时只允许导入到与导出时相同的key
+func resealValue(cli *config.Client, key, value, prefix, from string) (string, error) {
+	if !config.IsSecret(value) {
+		return value, nil
+	}
+	source := rebaseKey(key, prefix, from)
+	sealed, err := cli.Reseal(source, key, value)
+	switch {
+	case err == nil:
+		return sealed, nil
+	case errors.Is(err, config.ErrNoKeyring) && source == key:
+		return value, nil
+	case errors.Is(err, config.ErrNoKeyring):
+		return "", fmt.Errorf("%s: importing a secret under a different prefix requires a keyring, or export with -reveal", key)
+	default:
+		return "", fmt.Errorf("%s: %w (pass -from with the exported prefix, or export with -reveal)", key, err)
+	}
+}
+
+// rebaseKey 将prefix下的key换成from前缀
+func rebaseKey(key, prefix, from string) string {
+	prefix, from = strings.Trim(prefix, "/"), strings.Trim(from, "/")
+	if prefix == from {
+		return key
+	}
+	rel := key
+	if prefix != "" {
+		rel = strings.TrimPrefix(key, prefix+"/")
+	}
+	if from == "" {
+		return rel
+	}
+	return from + "/" + rel
+}
+
+// isFlagSet 是否在命令行中指定了该参数
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// maxTxnOps ETCD默认的单个事务最大操作数(--max-txn-ops)
+const maxTxnOps = 128
+
+// chunkOps 按size拆分操作
+func chunkOps(ops []config.Op, size int) [][]config.Op {
+	var chunks [][]config.Op
+	for len(ops) > size {
+		chunks = append(chunks, ops[:size])
+		ops = ops[size:]
+	}
+	if len(ops) > 0 {
+		chunks = append(chunks, ops)
+	}
+	return chunks
+}
+
+// relativeKeys 去掉key的前缀
+func relativeKeys(kvs map[string]string, prefix string) map[string]string {
+	if prefix == "" {
+		return kvs
+	}
+	m := make(map[string]string, len(kvs))
+	for k, v := range kvs {
+		m[strings.TrimPrefix(k, prefix+"/")] = v
+	}
+	return m
+}
+
+func runDiff(cli *config.Client, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "文件对应的前缀")
+	args, err := parseArgs(fs, args, 1, "[-prefix p] <file>")
+	if err != nil {
+		return err
+	}
+	changes, err := diffFile(cli, args[0], *prefix)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		printChange(c)
+	}
+	return nil
+}
+
+// change 文件与当前配置的差异,值为nil表示该侧不存在
+type change struct {
+	key  string
+	live *string
+	file *string
+}
+
+func printChange(c change) {
+	switch {
+	case c.live == nil:
+		fmt.Printf("+ %s=%s\n", c.key, *c.file)
+	case c.file == nil:
+		fmt.Printf("- %s=%s\n", c.key, *c.live)
+	default:
+		fmt.Printf("~ %s: %s -> %s\n", c.key, *c.live, *c.file)
+	}
+}
+
+// diffFile 对比文件与前缀下的当前配置,加密值按原样比较
+func diffFile(cli *config.Client, path, prefix string) ([]change, error) {
+	file, err := readFile(path, prefix)
+	if err != nil {
+		return nil, err
+	}
+	// 未指定前缀时只对比文件中出现的key
+	var live map[string]string
+	if prefix != "" {
+		live, err = cli.Provider().GetPrefix(strings.TrimSuffix(prefix, "/") + "/")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		live = make(map[string]string, len(file))
+		for k := range file {
+			v, err := cli.Provider().Get(k)
+			if err != nil {
+				return nil, err
+			}
+			if v != "" {
+				live[k] = v
+			}
+		}
+	}
+
+	var changes []change
+	for _, k := range sortedKeys(file) {
+		fv := file[k]
+		lv, ok := live[k]
+		switch {
+		case !ok:
+			changes = append(changes, change{key: k, file: &fv})
+		case lv != fv:
+			changes = append(changes, change{key: k, live: &lv, file: &fv})
+		}
+	}
+	for _, k := range sortedKeys(live) {
+		if _, ok := file[k]; !ok {
+			lv := live[k]
+			changes = append(changes, change{key: k, live: &lv})
+		}
+	}
+	return changes, nil
+}
+
+// readFile 读取YAML或JSON文件并展开为key/value,.json按JSON解析,其余按YAML解析
+func readFile(path, prefix string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]any)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		err = dec.Decode(&tree)
+	} else {
+		err = yaml.Unmarshal(b, &tree)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	kvs := config.Flatten(tree)
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return kvs, nil
+	}
+	m := make(map[string]string, len(kvs))
+	for k, v := range kvs {
+		m[prefix+"/"+k] = v
+	}
+	return m, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
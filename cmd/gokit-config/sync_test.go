@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudneedle/gokit/config"
+)
+
+func TestExportImport(t *testing.T) {
+	src, _ := config.New(config.WithProvider(config.NewMemory(map[string]string{
+		"admin/server_host": ":8081",
+		"admin/hosts/0":     "a",
+		"admin2/other":      "x",
+	})))
+	file := filepath.Join(t.TempDir(), "admin.yaml")
+	if err := runExport(src, []string{"-o", file, "admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, _ := config.New(config.WithProvider(config.NewMemory(map[string]string{
+		"admin/stale": "1",
+	})))
+	if err := runImport(dst, []string{"-prefix", "admin", "-prune", file}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := dst.GetPrefix("admin")
+	want := map[string]string{"admin/server_host": ":8081", "admin/hosts/0": "a"}
+	if len(got) != len(want) {
+		t.Fatalf("imported = %v", got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("imported %s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestChunkOps(t *testing.T) {
+	ops := make([]config.Op, 300)
+	for i := range ops {
+		ops[i] = config.PutOp(fmt.Sprint(i), "v")
+	}
+	chunks := chunkOps(ops, maxTxnOps)
+	if len(chunks) != 3 || len(chunks[0]) != 128 || len(chunks[2]) != 44 {
+		t.Fatalf("chunks = %d", len(chunks))
+	}
+}
+
+func TestImportSecretOtherPrefix(t *testing.T) {
+	key, _ := config.GenerateKey()
+	ring, err := config.ParseKeyring("k1:" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, _ := config.New(config.WithProvider(config.NewMemory(nil)), config.WithKeyring(ring))
+	if err = src.PutSecret("admin/db/password", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "admin.yaml")
+	if err = runExport(src, []string{"-o", file, "admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未指定导出时的前缀,密文无法在新key下解密
+	dst, _ := config.New(config.WithProvider(config.NewMemory(nil)), config.WithKeyring(ring))
+	if err = runImport(dst, []string{"-prefix", "admin2", file}); err == nil {
+		t.Fatal("import sealed value under another prefix without -from should fail")
+	}
+	if err = runImport(dst, []string{"-prefix", "admin2", "-from", "admin", file}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := dst.Get("admin2/db/password"); err != nil || v != "secret" {
+		t.Fatalf("imported secret = %q, %v", v, err)
+	}
+
+	// 没有密钥环时只能导入到相同的key
+	plain, _ := config.New(config.WithProvider(config.NewMemory(nil)))
+	if err = runImport(plain, []string{"-prefix", "admin2", "-from", "admin", file}); err == nil {
+		t.Fatal("resealing without keyring should fail")
+	}
+	if err = runImport(plain, []string{"-prefix", "admin", file}); err != nil {
+		t.Fatal(err)
+	}
+}
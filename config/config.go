@@ -1,17 +1,34 @@
 package config
 
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
 type Type int
 
 const (
-	ETCD Type = iota // ETCD
-	YAML             // YAML
+	ETCD   Type = iota // ETCD
+	YAML               // YAML
+	MEMORY             // 内存,用于单元测试
 )
 
 // Client 配置客户端
 type Client struct {
-	t    Type   // 配置类型
-	path string // 配置路径:如果是ETCD,则为ETCD的地址,多个地址用逗号分隔;如果是YAML,则为YAML文件的路径
-	Etcd *Etcd  // ETCD客户端,如果是YAML,则为nil
+	t    Type     // 配置类型
+	path string   // 配置路径:如果是ETCD,则为ETCD的地址,多个地址用逗号分隔;如果是YAML,则为YAML文件的路径
+	p    Provider // 配置后端
+
+	timeout time.Duration         // ETCD请求超时时间
+	metrics prometheus.Registerer // ETCD客户端指标的注册位置,为nil时不采集
+
+	keyring *Keyring        // 密钥环,用于读写加密值
+	schemas *SchemaRegistry // 配置约束
+	Etcd    *Etcd           // ETCD客户端,如果不是ETCD,则为nil
+	Yaml    *Yaml           // YAML客户端,如果不是YAML,则为nil
 }
 
 // ClientOption 配置客户端选项
@@ -31,6 +48,27 @@ func WithPath(path string) ClientOption {
 	}
 }
 
+// WithTimeout 设置ETCD单次请求的超时时间,默认3秒
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithEtcdMetrics 将ETCD客户端的gRPC请求指标注册到reg,如 web.Metrics.Registry()
+func WithEtcdMetrics(reg prometheus.Registerer) ClientOption {
+	return func(c *Client) {
+		c.metrics = reg
+	}
+}
+
+// WithProvider 设置自定义配置后端,设置后忽略WithType与WithPath
+func WithProvider(p Provider) ClientOption {
+	return func(c *Client) {
+		c.p = p
+	}
+}
+
 // New 创建配置客户端
 func New(opts ...ClientOption) (*Client, error) {
 	cli := new(Client)
@@ -38,21 +76,167 @@ func New(opts ...ClientOption) (*Client, error) {
 		opt(cli)
 	}
 
-	if cli.t == ETCD {
+	if cli.p != nil {
+		cli.Etcd, _ = cli.p.(*Etcd)
+		cli.Yaml, _ = cli.p.(*Yaml)
+		return cli, nil
+	}
+
+	switch cli.t {
+	case ETCD:
 		// 创建ETCD客户端
-		etcd, err := newEtcdClient(cli.path)
+		etcd, err := newEtcdClient(cli.path, cli.timeout, cli.metrics)
 		if err != nil {
 			return nil, err
 		}
 		cli.Etcd = etcd
+		cli.p = etcd
+	case YAML:
+		// 创建YAML客户端
+		y, err := newYamlClient(cli.path)
+		if err != nil {
+			return nil, err
+		}
+		cli.Yaml = y
+		cli.p = y
+	case MEMORY:
+		cli.p = NewMemory(nil)
 	}
 	return cli, nil
 }
 
+// Provider 当前使用的配置后端
+func (c *Client) Provider() Provider {
+	return c.p
+}
+
+// Get 获取配置,加密值自动解密,设置了约束时校验非空值
+func (c *Client) Get(key string) (string, error) {
+	v, err := c.p.Get(key)
+	if err != nil {
+		return "", err
+	}
+	if v, err = c.reveal(key, v); err != nil {
+		return "", err
+	}
+	if err = c.checkRead(key, v); err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
+// GetPrefix 获取前缀配置,加密值自动解密,设置了约束时校验每个值
+func (c *Client) GetPrefix(prefix string) (map[string]string, error) {
+	m, err := c.p.GetPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range m {
+		if v, err = c.reveal(k, v); err != nil {
+			return nil, err
+		}
+		if err = c.checkRead(k, v); err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+// Watch 监听配置,加密值自动解密,解密失败时记录日志并跳过该变化
+func (c *Client) Watch(key string, callback func(key string, value string)) error {
+	return c.p.Watch(key, func(k, v string) {
+		plain, err := c.reveal(k, v)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		callback(k, plain)
+	})
+}
+
+// WatchPrefix 监听前缀配置,加密值自动解密,解密失败的key记录日志后跳过
+func (c *Client) WatchPrefix(prefix string, callback func(map[string]string)) error {
+	return c.p.WatchPrefix(prefix, func(m map[string]string) {
+		if c.revealAll(m) {
+			callback(m)
+		}
+	})
+}
+
+// revealAll 原地解密监听到的加密值,解密失败的key记录日志后移除,返回是否还有剩余的变化
+func (c *Client) revealAll(m map[string]string) bool {
+	for k, v := range m {
+		plain, err := c.reveal(k, v)
+		if err != nil {
+			log.Println(err)
+			delete(m, k)
+			continue
+		}
+		m[k] = plain
+	}
+	return len(m) > 0
+}
+
+// WatchPrefixContext 监听前缀配置,加密值自动解密,阻塞直到ctx取消或后端关闭,ctx取消时返回nil
+//
+// 后端不支持取消监听时(如YAML),ctx取消后不再回调,但底层的监听直到后端关闭才结束
+func (c *Client) WatchPrefixContext(ctx context.Context, prefix string, callback func(map[string]string)) error {
+	if w, ok := c.p.(contextWatcher); ok {
+		return w.WatchPrefixContext(ctx, prefix, func(evs []Event) {
+			m := make(map[string]string, len(evs))
+			for _, ev := range evs {
+				m[ev.Key] = ev.Value
+			}
+			if c.revealAll(m) {
+				callback(m)
+			}
+		})
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.p.WatchPrefix(prefix, func(m map[string]string) {
+			if ctx.Err() == nil && c.revealAll(m) {
+				callback(m)
+			}
+		})
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// Put 设置配置,设置了约束时先校验
+func (c *Client) Put(key, value string) error {
+	if err := c.check(key, value); err != nil {
+		return err
+	}
+	return c.p.Put(key, value)
+}
+
+// PutMany 原子地设置多个配置,设置了约束时先校验全部配置,任一不通过则都不写入
+func (c *Client) PutMany(kvs map[string]string) error {
+	for k, v := range kvs {
+		if err := c.check(k, v); err != nil {
+			return err
+		}
+	}
+	return putMany(c.p, kvs)
+}
+
+// Delete 删除配置
+func (c *Client) Delete(key string) error {
+	return c.p.Delete(key)
+}
+
 // Close 关闭配置客户端
 func (c *Client) Close() error {
-	if c.Etcd != nil {
-		return c.Etcd.Close()
+	if c.p != nil {
+		return c.p.Close()
 	}
 	return nil
 }
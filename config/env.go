@@ -0,0 +1,173 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrReadOnly 配置后端只读
+var ErrReadOnly = errors.New("config: provider is read-only")
+
+// Env 环境变量配置,只读
+//
+// key admin/server_host 对应环境变量 APP_ADMIN__SERVER_HOST(前缀为APP时),
+// 斜杠或点号对应双下划线,其余字符转为大写
+type Env struct {
+	prefix string
+	static
+}
+
+// NewEnv 创建环境变量配置,prefix为环境变量前缀,可以为空
+func NewEnv(prefix string) *Env {
+	return &Env{
+		prefix: strings.TrimSuffix(strings.ToUpper(prefix), "_"),
+		static: newStatic(),
+	}
+}
+
+// EnvName key对应的环境变量名
+func (e *Env) EnvName(key string) string {
+	name := strings.ToUpper(strings.Join(splitKey(key), "__"))
+	if e.prefix == "" {
+		return name
+	}
+	return e.prefix + "_" + name
+}
+
+// Get 获取配置
+func (e *Env) Get(key string) (string, error) {
+	return os.Getenv(e.EnvName(key)), nil
+}
+
+// GetPrefix 获取前缀配置,返回的key为斜杠分隔的小写形式
+func (e *Env) GetPrefix(prefix string) (map[string]string, error) {
+	prefix = normalizeKey(prefix)
+	var m map[string]string
+	for _, kv := range os.Environ() {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		key, ok := e.key(name)
+		if !ok || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]string)
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// key 环境变量名对应的key
+func (e *Env) key(name string) (string, bool) {
+	if e.prefix != "" {
+		if !strings.HasPrefix(name, e.prefix+"_") {
+			return "", false
+		}
+		name = name[len(e.prefix)+1:]
+	}
+	if name == "" {
+		return "", false
+	}
+	return strings.ToLower(strings.ReplaceAll(name, "__", "/")), true
+}
+
+// Flags 命令行参数配置,只读,只有显式设置过的参数才生效
+//
+// key admin/server_host 对应参数 -admin.server_host
+type Flags struct {
+	fs *flag.FlagSet
+	static
+}
+
+// NewFlags 创建命令行参数配置,fs为nil时使用flag.CommandLine
+func NewFlags(fs *flag.FlagSet) *Flags {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	return &Flags{fs: fs, static: newStatic()}
+}
+
+// FlagName key对应的参数名
+func FlagName(key string) string {
+	return strings.Join(splitKey(key), ".")
+}
+
+// Get 获取配置
+func (f *Flags) Get(key string) (string, error) {
+	name := FlagName(key)
+	var value string
+	f.fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			value = fl.Value.String()
+		}
+	})
+	return value, nil
+}
+
+// GetPrefix 获取前缀配置,返回的key为斜杠分隔
+func (f *Flags) GetPrefix(prefix string) (map[string]string, error) {
+	prefix = normalizeKey(prefix)
+	var m map[string]string
+	f.fs.Visit(func(fl *flag.Flag) {
+		key := normalizeKey(fl.Name)
+		if !strings.HasPrefix(key, prefix) {
+			return
+		}
+		if m == nil {
+			m = make(map[string]string)
+		}
+		m[key] = fl.Value.String()
+	})
+	return m, nil
+}
+
+// static 只读且不会变化的配置后端的公共实现
+type static struct {
+	done chan struct{}
+	once *sync.Once
+}
+
+func newStatic() static {
+	return static{done: make(chan struct{}), once: new(sync.Once)}
+}
+
+// Watch 配置不会变化,阻塞直到关闭
+func (s static) Watch(string, func(key string, value string)) error {
+	<-s.done
+	return nil
+}
+
+// WatchPrefix 配置不会变化,阻塞直到关闭
+func (s static) WatchPrefix(string, func(map[string]string)) error {
+	<-s.done
+	return nil
+}
+
+// Put 只读
+func (s static) Put(string, string) error {
+	return ErrReadOnly
+}
+
+// PutMany 只读
+func (s static) PutMany(map[string]string) error {
+	return ErrReadOnly
+}
+
+// Delete 只读
+func (s static) Delete(string) error {
+	return ErrReadOnly
+}
+
+// Close 结束所有监听
+func (s static) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
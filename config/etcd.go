@@ -2,32 +2,72 @@ package config
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	grpcprom "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+	"log"
 	"strings"
 	"time"
 )
 
+// defaultTimeout ETCD请求的默认超时时间
+const defaultTimeout = 3 * time.Second
+
 type Etcd struct {
-	host   []string
-	client *clientv3.Client
+	host    []string
+	client  *clientv3.Client
+	timeout time.Duration // 单次请求超时时间
 }
 
-// newEtcdClient 创建ETCD客户端
-func newEtcdClient(path string) (*Etcd, error) {
+// newEtcdClient 创建ETCD客户端,reg不为nil时将gRPC客户端指标注册到reg
+func newEtcdClient(path string, timeout time.Duration, reg prometheus.Registerer) (*Etcd, error) {
 	host := strings.Split(path, ",")
-	cli, err := clientv3.New(clientv3.Config{
+	cfg := clientv3.Config{
 		Endpoints:   host,
 		DialTimeout: 5 * time.Second,
-	})
+	}
+	if reg != nil {
+		m, err := etcdMetrics(reg)
+		if err != nil {
+			return nil, err
+		}
+		cfg.DialOptions = []grpc.DialOption{
+			grpc.WithUnaryInterceptor(m.UnaryClientInterceptor()),
+			grpc.WithStreamInterceptor(m.StreamClientInterceptor()),
+		}
+	}
+	cli, err := clientv3.New(cfg)
 	if err != nil {
 		return nil, err
 	}
-	return &Etcd{host: host, client: cli}, nil
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Etcd{host: host, client: cli, timeout: timeout}, nil
+}
+
+// etcdMetrics 注册gRPC客户端指标,已注册时复用已有的指标
+func etcdMetrics(reg prometheus.Registerer) (*grpcprom.ClientMetrics, error) {
+	m := grpcprom.NewClientMetrics()
+	m.EnableClientHandlingTimeHistogram()
+	if err := reg.Register(m); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(*grpcprom.ClientMetrics); ok {
+				return existing, nil
+			}
+		}
+		return nil, err
+	}
+	return m, nil
 }
 
 // Get 获取配置
 func (e *Etcd) Get(key string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
 	defer cancel()
 	resp, err := e.client.Get(ctx, key)
 	if err != nil {
@@ -42,18 +82,25 @@ func (e *Etcd) Get(key string) (string, error) {
 
 // Watch 监听配置
 func (e *Etcd) Watch(key string, callback func(key string, value string)) error {
-	rch := e.client.Watch(context.Background(), key)
-	for wresp := range rch {
-		for _, ev := range wresp.Events {
-			callback(string(ev.Kv.Key), string(ev.Kv.Value))
+	return e.WatchContext(context.Background(), key, func(ev Event) {
+		callback(ev.Key, ev.Value)
+	})
+}
+
+// WatchContext 监听配置,阻塞直到ctx取消或客户端关闭,此时返回nil
+//
+// 断线重连或历史被压缩后从最后看到的版本继续监听
+func (e *Etcd) WatchContext(ctx context.Context, key string, callback func(ev Event)) error {
+	return e.watch(ctx, key, 0, nil, func(evs []Event) {
+		for _, ev := range evs {
+			callback(ev)
 		}
-	}
-	return nil
+	})
 }
 
 // GetPrefix 获取前缀配置
 func (e *Etcd) GetPrefix(prefix string) (map[string]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
 	defer cancel()
 	resp, err := e.client.Get(ctx, prefix, clientv3.WithPrefix())
 	if err != nil {
@@ -72,20 +119,109 @@ func (e *Etcd) GetPrefix(prefix string) (map[string]string, error) {
 
 // WatchPrefix 监听前缀配置
 func (e *Etcd) WatchPrefix(prefix string, callback func(map[string]string)) error {
-	rch := e.client.Watch(context.Background(), prefix, clientv3.WithPrefix())
-	for wresp := range rch {
-		m := make(map[string]string)
-		for _, ev := range wresp.Events {
-			m[string(ev.Kv.Key)] = string(ev.Kv.Value)
+	return e.WatchPrefixContext(context.Background(), prefix, func(evs []Event) {
+		m := make(map[string]string, len(evs))
+		for _, ev := range evs {
+			m[ev.Key] = ev.Value
 		}
 		callback(m)
+	})
+}
+
+// WatchPrefixContext 监听前缀配置,同一版本的事件一次回调,阻塞直到ctx取消或客户端关闭,此时返回nil
+//
+// 断线重连或历史被压缩后从最后看到的版本继续监听
+func (e *Etcd) WatchPrefixContext(ctx context.Context, prefix string, callback func(evs []Event)) error {
+	return e.watch(ctx, prefix, 0, []clientv3.OpOption{clientv3.WithPrefix()}, callback)
+}
+
+// WatchPrefixFrom 从版本rev之后开始监听前缀配置,其余同WatchPrefixContext
+//
+// 先读取再监听时传入读取结果的版本,两次调用之间的变更不会丢失
+func (e *Etcd) WatchPrefixFrom(ctx context.Context, prefix string, rev int64, callback func(evs []Event)) error {
+	return e.watch(ctx, prefix, rev, []clientv3.OpOption{clientv3.WithPrefix()}, callback)
+}
+
+// watch 监听rev之后的变化并在中断后从最后看到的版本恢复,rev为0时从当前版本开始
+func (e *Etcd) watch(ctx context.Context, key string, rev int64, opts []clientv3.OpOption, callback func(evs []Event)) error {
+	if rev == 0 {
+		// 先取当前版本,保证首次重连时不丢事件
+		getCtx, cancel := context.WithTimeout(ctx, e.timeout)
+		resp, err := e.client.Get(getCtx, key, append([]clientv3.OpOption{clientv3.WithCountOnly()}, opts...)...)
+		cancel()
+		if err != nil {
+			if e.stopped(ctx) {
+				return nil
+			}
+			return err
+		}
+		rev = resp.Header.Revision
 	}
-	return nil
+
+	for {
+		wctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+		rch := e.client.Watch(wctx, key, append([]clientv3.OpOption{clientv3.WithRev(rev + 1)}, opts...)...)
+		for wresp := range rch {
+			var (
+				evs []Event
+				err error
+			)
+			evs, rev, err = applyWatchResponse(rev, wresp)
+			if err != nil {
+				if !e.stopped(ctx) {
+					log.Printf("config: etcd watch %s: %v, resume from revision %d", key, err, rev+1)
+				}
+				break
+			}
+			if len(evs) > 0 {
+				callback(evs)
+			}
+		}
+		cancel()
+
+		if e.stopped(ctx) {
+			return nil
+		}
+		// 稍后重连
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-e.client.Ctx().Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// applyWatchResponse 转换监听到的事件,返回事件、最后看到的版本与监听中断的原因
+//
+// 历史已被压缩时从压缩点继续,期间的中间变更无法找回
+func applyWatchResponse(rev int64, wresp clientv3.WatchResponse) ([]Event, int64, error) {
+	if wresp.CompactRevision != 0 {
+		return nil, wresp.CompactRevision - 1, wresp.Err()
+	}
+	if err := wresp.Err(); err != nil {
+		return nil, rev, err
+	}
+	if len(wresp.Events) == 0 {
+		return nil, rev, nil
+	}
+	evs := make([]Event, 0, len(wresp.Events))
+	for _, ev := range wresp.Events {
+		evs = append(evs, newEvent(ev))
+		rev = ev.Kv.ModRevision
+	}
+	return evs, rev, nil
+}
+
+// stopped ctx已取消或客户端已关闭
+func (e *Etcd) stopped(ctx context.Context) bool {
+	return ctx.Err() != nil || e.client.Ctx().Err() != nil
 }
 
 // Put 设置配置
 func (e *Etcd) Put(key, value string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
 	defer cancel()
 	_, err := e.client.Put(ctx, key, value)
 	if err != nil {
@@ -94,9 +230,105 @@ func (e *Etcd) Put(key, value string) error {
 	return nil
 }
 
+// PutMany 在一个事务中设置多个配置
+func (e *Etcd) PutMany(kvs map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	ops := make([]clientv3.Op, 0, len(kvs))
+	for k, v := range kvs {
+		ops = append(ops, clientv3.OpPut(k, v))
+	}
+	_, err := e.client.Txn(ctx).Then(ops...).Commit()
+	return err
+}
+
+// GetRevision 获取配置及其最后修改的版本,不存在时版本为0
+func (e *Etcd) GetRevision(key string) (string, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	resp, err := e.client.Get(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", 0, nil
+	}
+	return string(resp.Kvs[0].Value), resp.Kvs[0].ModRevision, nil
+}
+
+// Txn 所有条件满足时执行全部操作,否则不执行任何操作并返回*ConflictError
+//
+// ctx没有截止时间时使用客户端的超时时间
+func (e *Etcd) Txn(ctx context.Context, cmps []Compare, ops ...Op) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	conds := make([]clientv3.Cmp, 0, len(cmps))
+	gets := make([]clientv3.Op, 0, len(cmps))
+	for _, c := range cmps {
+		switch c.Target {
+		case CompareValue:
+			conds = append(conds, clientv3.Compare(clientv3.Value(c.Key), "=", c.Value))
+		case CompareModRevision:
+			conds = append(conds, clientv3.Compare(clientv3.ModRevision(c.Key), "=", c.Revision))
+		default:
+			return fmt.Errorf("config: unknown compare target %d", c.Target)
+		}
+		// 失败时读取当前值,用于返回冲突详情
+		gets = append(gets, clientv3.OpGet(c.Key))
+	}
+	thens := make([]clientv3.Op, 0, len(ops))
+	for _, op := range ops {
+		switch op.Type {
+		case OpPut:
+			thens = append(thens, clientv3.OpPut(op.Key, op.Value))
+		case OpDelete:
+			thens = append(thens, clientv3.OpDelete(op.Key))
+		default:
+			return fmt.Errorf("config: unknown op type %d", op.Type)
+		}
+	}
+
+	resp, err := e.client.Txn(ctx).If(conds...).Then(thens...).Else(gets...).Commit()
+	if err != nil {
+		return err
+	}
+	if resp.Succeeded {
+		return nil
+	}
+	for i, c := range cmps {
+		var (
+			value  string
+			rev    int64
+			exists bool
+		)
+		if kvs := resp.Responses[i].GetResponseRange().GetKvs(); len(kvs) > 0 {
+			value, rev, exists = string(kvs[0].Value), kvs[0].ModRevision, true
+		}
+		if !c.match(value, rev, exists) {
+			return c.conflict(value, rev, exists)
+		}
+	}
+	// 读取时数据已再次变化
+	return &ConflictError{Key: cmps[0].Key, Expected: "unchanged", Actual: "changed concurrently"}
+}
+
+// PutIfAbsent key不存在时设置,已存在时返回*ConflictError
+func (e *Etcd) PutIfAbsent(key, value string) error {
+	return e.Txn(context.Background(), []Compare{Absent(key)}, PutOp(key, value))
+}
+
+// CompareAndSwap key的值等于old时设置为new,否则返回*ConflictError
+func (e *Etcd) CompareAndSwap(key, old, new string) error {
+	return e.Txn(context.Background(), []Compare{ValueEquals(key, old)}, PutOp(key, new))
+}
+
 // Delete 删除配置
 func (e *Etcd) Delete(key string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
 	defer cancel()
 	_, err := e.client.Delete(ctx, key)
 	if err != nil {
@@ -105,6 +337,42 @@ func (e *Etcd) Delete(key string) error {
 	return nil
 }
 
+// Client 底层的ETCD客户端,用于服务注册、分布式锁等扩展
+func (e *Etcd) Client() *clientv3.Client {
+	return e.client
+}
+
+// Status 检查集群状态,任一节点可用且集群有leader时返回nil
+func (e *Etcd) Status(ctx context.Context) error {
+	eps := e.client.Endpoints()
+	if len(eps) == 0 {
+		return fmt.Errorf("config: etcd has no endpoints")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errc := make(chan error, len(eps))
+	for _, ep := range eps {
+		ep := ep
+		go func() {
+			resp, err := e.client.Status(ctx, ep)
+			if err == nil && resp.Leader == 0 {
+				err = fmt.Errorf("config: etcd %s has no leader", ep)
+			}
+			errc <- err
+		}()
+	}
+	// 并发探测,任意一个节点正常即返回
+	var last error
+	for range eps {
+		err := <-errc
+		if err == nil {
+			return nil
+		}
+		last = err
+	}
+	return last
+}
+
 // Close 关闭ETCD客户端
 func (e *Etcd) Close() error {
 	return e.client.Close()
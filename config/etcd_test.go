@@ -0,0 +1,50 @@
+package config
+
+import (
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestNewEvent(t *testing.T) {
+	put := newEvent(&clientv3.Event{
+		Type: clientv3.EventTypePut,
+		Kv:   &mvccpb.KeyValue{Key: []byte("admin/host"), Value: []byte(":8080"), ModRevision: 7},
+	})
+	if put.Type != EventPut || put.Key != "admin/host" || put.Value != ":8080" || put.Revision != 7 {
+		t.Fatalf("put event = %+v", put)
+	}
+	del := newEvent(&clientv3.Event{
+		Type: clientv3.EventTypeDelete,
+		Kv:   &mvccpb.KeyValue{Key: []byte("admin/host"), Value: []byte(":8080"), ModRevision: 8},
+	})
+	if del.Type != EventDelete || del.Value != "" || del.Revision != 8 {
+		t.Fatalf("delete event = %+v", del)
+	}
+}
+
+func TestApplyWatchResponse(t *testing.T) {
+	evs, rev, err := applyWatchResponse(5, clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: clientv3.EventTypePut, Kv: &mvccpb.KeyValue{Key: []byte("a"), Value: []byte("1"), ModRevision: 6}},
+		{Type: clientv3.EventTypeDelete, Kv: &mvccpb.KeyValue{Key: []byte("b"), ModRevision: 6}},
+	}})
+	if err != nil || rev != 6 || len(evs) != 2 || evs[1].Type != EventDelete {
+		t.Fatalf("events = %+v, rev = %d, err = %v", evs, rev, err)
+	}
+
+	// 进度通知不改变版本
+	if evs, rev, err = applyWatchResponse(6, clientv3.WatchResponse{}); err != nil || rev != 6 || evs != nil {
+		t.Fatalf("progress notify = %+v, rev = %d, err = %v", evs, rev, err)
+	}
+
+	// 历史被压缩时从压缩点继续
+	if _, rev, err = applyWatchResponse(6, clientv3.WatchResponse{CompactRevision: 20}); err == nil || rev != 19 {
+		t.Fatalf("compacted rev = %d, err = %v", rev, err)
+	}
+
+	// 其他错误保留最后看到的版本
+	if _, rev, err = applyWatchResponse(6, clientv3.WatchResponse{Canceled: true}); err == nil || rev != 6 {
+		t.Fatalf("canceled rev = %d, err = %v", rev, err)
+	}
+}
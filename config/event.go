@@ -0,0 +1,44 @@
+package config
+
+import clientv3 "go.etcd.io/etcd/client/v3"
+
+// EventType 配置变更类型
+type EventType int
+
+const (
+	EventPut    EventType = iota // PUT
+	EventDelete                  // DELETE
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "PUT"
+	case EventDelete:
+		return "DELETE"
+	}
+	return "UNKNOWN"
+}
+
+// Event 配置变更事件
+type Event struct {
+	Type     EventType // 变更类型
+	Key      string    // 配置key
+	Value    string    // 配置值,DELETE时为空
+	Revision int64     // 变更所在的版本
+}
+
+// newEvent 转换ETCD事件
+func newEvent(ev *clientv3.Event) Event {
+	e := Event{
+		Type:     EventPut,
+		Key:      string(ev.Kv.Key),
+		Value:    string(ev.Kv.Value),
+		Revision: ev.Kv.ModRevision,
+	}
+	if ev.Type == clientv3.EventTypeDelete {
+		e.Type = EventDelete
+		e.Value = ""
+	}
+	return e
+}
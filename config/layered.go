@@ -0,0 +1,326 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 常用的配置层名称
+const (
+	LayerEnv      = "env"
+	LayerFlags    = "flags"
+	LayerEtcd     = "etcd"
+	LayerYaml     = "yaml"
+	LayerDefaults = "defaults"
+)
+
+// Layer 配置层
+type Layer struct {
+	Name     string   // 配置层名称,用于追踪配置来源
+	Provider Provider // 配置后端
+}
+
+// Layered 分层配置,按层的顺序决定优先级,靠前的层覆盖靠后的层,值为空视为不存在
+//
+// 推荐的顺序为 环境变量 > 命令行参数 > ETCD > YAML > 默认值
+//
+// example:
+//
+//	defaults, _ := config.NewDefaults("admin", ServerConfig{Host: ":8080"})
+//	layered := config.NewLayered(
+//	  config.Layer{Name: config.LayerEnv, Provider: config.NewEnv("APP")},
+//	  config.Layer{Name: config.LayerFlags, Provider: config.NewFlags(nil)},
+//	  config.Layer{Name: config.LayerEtcd, Provider: etcdCli.Etcd},
+//	  config.Layer{Name: config.LayerYaml, Provider: yamlCli.Yaml},
+//	  config.Layer{Name: config.LayerDefaults, Provider: defaults},
+//	)
+//	cli, err := config.New(config.WithProvider(layered))
+type Layered struct {
+	layers []Layer
+}
+
+// NewLayered 创建分层配置
+func NewLayered(layers ...Layer) *Layered {
+	return &Layered{layers: layers}
+}
+
+// Layers 所有配置层,按优先级从高到低
+func (l *Layered) Layers() []Layer {
+	return l.layers
+}
+
+// Get 获取优先级最高的非空配置
+func (l *Layered) Get(key string) (string, error) {
+	v, _, err := l.lookup(key)
+	return v, err
+}
+
+// Source 配置生效值所在的层,用于排查配置来源
+func (l *Layered) Source(key string) (layer string, ok bool, err error) {
+	_, layer, err = l.lookup(key)
+	return layer, layer != "", err
+}
+
+func (l *Layered) lookup(key string) (value, layer string, err error) {
+	for _, ly := range l.layers {
+		v, err := ly.Provider.Get(key)
+		if err != nil {
+			return "", "", fmt.Errorf("config: layer %s: %w", ly.Name, err)
+		}
+		if v != "" {
+			return v, ly.Name, nil
+		}
+	}
+	return "", "", nil
+}
+
+// GetPrefix 合并各层的前缀配置,高优先级覆盖低优先级
+func (l *Layered) GetPrefix(prefix string) (map[string]string, error) {
+	values, _, err := l.merge(prefix)
+	return values, err
+}
+
+// Sources 前缀下每个生效配置所在的层,key为配置key,value为层名称
+func (l *Layered) Sources(prefix string) (map[string]string, error) {
+	_, sources, err := l.merge(prefix)
+	return sources, err
+}
+
+func (l *Layered) merge(prefix string) (values, sources map[string]string, err error) {
+	for i := len(l.layers) - 1; i >= 0; i-- {
+		ly := l.layers[i]
+		m, err := ly.Provider.GetPrefix(prefix)
+		if err != nil {
+			return nil, nil, fmt.Errorf("config: layer %s: %w", ly.Name, err)
+		}
+		for k, v := range m {
+			if v == "" {
+				continue
+			}
+			if values == nil {
+				values = make(map[string]string)
+				sources = make(map[string]string)
+			}
+			values[k] = v
+			sources[k] = ly.Name
+		}
+	}
+	// 由调用层判断是否存在
+	return values, sources, nil
+}
+
+// Watch 监听所有层,生效值变化时回调,阻塞直到所有层关闭
+func (l *Layered) Watch(key string, callback func(key string, value string)) error {
+	var mu sync.Mutex
+	last, err := l.Get(key)
+	if err != nil {
+		return err
+	}
+	return l.each(func(p Provider) error {
+		return p.Watch(key, func(k, _ string) {
+			mu.Lock()
+			defer mu.Unlock()
+			v, err := l.Get(k)
+			if err != nil || v == last {
+				return
+			}
+			last = v
+			callback(k, v)
+		})
+	})
+}
+
+// WatchPrefix 监听所有层,回调生效值发生变化的配置,阻塞直到所有层关闭
+func (l *Layered) WatchPrefix(prefix string, callback func(map[string]string)) error {
+	var mu sync.Mutex
+	last, err := l.GetPrefix(prefix)
+	if err != nil {
+		return err
+	}
+	return l.each(func(p Provider) error {
+		return p.WatchPrefix(prefix, func(map[string]string) {
+			mu.Lock()
+			defer mu.Unlock()
+			cur, err := l.GetPrefix(prefix)
+			if err != nil {
+				return
+			}
+			changed := diffKvs(last, cur)
+			last = cur
+			if len(changed) > 0 {
+				callback(changed)
+			}
+		})
+	})
+}
+
+// each 并发执行每一层的监听,返回第一个错误
+func (l *Layered) each(fn func(p Provider) error) error {
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+	for _, ly := range l.layers {
+		wg.Add(1)
+		go func(ly Layer) {
+			defer wg.Done()
+			if err := fn(ly.Provider); err != nil {
+				once.Do(func() {
+					first = fmt.Errorf("config: layer %s: %w", ly.Name, err)
+				})
+			}
+		}(ly)
+	}
+	wg.Wait()
+	return first
+}
+
+// Put 写入优先级最高的可写层,注意更高优先级的只读层仍会覆盖该值
+func (l *Layered) Put(key, value string) error {
+	return l.write(func(p Provider) error {
+		return p.Put(key, value)
+	})
+}
+
+// PutMany 原子地写入优先级最高的可写层
+func (l *Layered) PutMany(kvs map[string]string) error {
+	return l.write(func(p Provider) error {
+		return putMany(p, kvs)
+	})
+}
+
+// Delete 从优先级最高的可写层删除
+func (l *Layered) Delete(key string) error {
+	return l.write(func(p Provider) error {
+		return p.Delete(key)
+	})
+}
+
+func (l *Layered) write(fn func(p Provider) error) error {
+	for _, ly := range l.layers {
+		err := fn(ly.Provider)
+		if errors.Is(err, ErrReadOnly) {
+			continue
+		}
+		return err
+	}
+	return ErrReadOnly
+}
+
+// Close 关闭所有层
+func (l *Layered) Close() error {
+	var first error
+	for _, ly := range l.layers {
+		if err := ly.Provider.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// NewDefaults 把结构体的字段值展开为前缀下的内存配置,作为最低优先级的默认值层
+//
+// 字段的key规则同Client.Unmarshal,零值字段使用 default:"..." 标签
+func NewDefaults(prefix string, v any) (*Memory, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: defaults must be a struct, got %T", v)
+	}
+	kvs := make(map[string]string)
+	if err := flattenStruct(kvs, strings.TrimSuffix(prefix, "/"), rv); err != nil {
+		return nil, err
+	}
+	return NewMemory(kvs), nil
+}
+
+func flattenStruct(kvs map[string]string, base string, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, ok := f.Tag.Lookup("config")
+		if name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && !ok && fv.Kind() == reflect.Struct {
+			if err := flattenStruct(kvs, base, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+		key := joinKey(base, name)
+		if fv.IsZero() {
+			if def := f.Tag.Get("default"); def != "" {
+				kvs[key] = def
+			}
+			continue
+		}
+		if err := flattenValue(kvs, key, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func flattenValue(kvs map[string]string, key string, v reflect.Value) error {
+	if isScalar(v.Type()) {
+		s, err := formatScalar(v)
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", key, err)
+		}
+		kvs[key] = s
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return flattenValue(kvs, key, v.Elem())
+	case reflect.Struct:
+		return flattenStruct(kvs, key, v)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := flattenValue(kvs, joinKey(key, strconv.Itoa(i)), v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := flattenValue(kvs, joinKey(key, fmt.Sprint(iter.Key())), iter.Value()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("config: %s: unsupported type %s", key, v.Type())
+}
+
+// formatScalar 把字段值格式化为字符串,是setScalar的逆操作
+func formatScalar(v reflect.Value) (string, error) {
+	if m, ok := v.Interface().(interface{ MarshalText() ([]byte, error) }); ok {
+		b, err := m.MarshalText()
+		return string(b), err
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String(), nil
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestLayered(t *testing.T) {
+	t.Setenv("APP_ADMIN__LOG_PATH", "env.log")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("admin.server_host", ":8080", "")
+	if err := fs.Parse([]string{"-admin.server_host=:9090"}); err != nil {
+		t.Fatal(err)
+	}
+
+	defaults, err := NewDefaults("admin", testDB{Host: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layered := NewLayered(
+		Layer{Name: LayerEnv, Provider: NewEnv("APP")},
+		Layer{Name: LayerFlags, Provider: NewFlags(fs)},
+		Layer{Name: LayerEtcd, Provider: NewMemory(map[string]string{
+			"admin/server_host": ":8081",
+			"admin/log_path":    "etcd.log",
+			"admin/host":        "10.0.0.1",
+		})},
+		Layer{Name: LayerDefaults, Provider: defaults},
+	)
+
+	m, err := layered.GetPrefix("admin/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"admin/server_host": ":9090",
+		"admin/log_path":    "env.log",
+		"admin/host":        "10.0.0.1",
+		"admin/port":        "3306",
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Fatalf("get prefix %s = %q, want %q", k, m[k], v)
+		}
+	}
+
+	sources, err := layered.Sources("admin/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sources["admin/server_host"] != LayerFlags || sources["admin/port"] != LayerDefaults {
+		t.Fatalf("sources = %v", sources)
+	}
+
+	// 只读层跳过,写入ETCD层
+	if err = layered.Put("admin/debug", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if layer, ok, _ := layered.Source("admin/debug"); !ok || layer != LayerEtcd {
+		t.Fatalf("source admin/debug = %q", layer)
+	}
+	if err = layered.PutMany(map[string]string{"admin/a": "1", "admin/b": "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if layer, ok, _ := layered.Source("admin/b"); !ok || layer != LayerEtcd {
+		t.Fatalf("source admin/b = %q", layer)
+	}
+}
@@ -0,0 +1,326 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+var (
+	// ErrLocked TryLock时锁已被其他会话持有
+	ErrLocked = concurrency.ErrLocked
+	// ErrNotLocked 未持有锁
+	ErrNotLocked = errors.New("config: mutex is not locked")
+	// ErrNotLeader 未当选
+	ErrNotLeader = errors.New("config: not the leader")
+	// ErrClosed 锁或选主已关闭
+	ErrClosed = errors.New("config: closed")
+)
+
+// newSession 创建绑定租约的会话,ttl小于1秒时按1秒计
+func (e *Etcd) newSession(ctx context.Context, ttl time.Duration) (*concurrency.Session, error) {
+	sec := int(ttl / time.Second)
+	if sec < 1 {
+		sec = 1
+	}
+	return concurrency.NewSession(e.client, concurrency.WithTTL(sec), concurrency.WithContext(ctx))
+}
+
+// Mutex 基于ETCD的分布式锁,持锁期间自动续约,进程退出后租约过期自动释放
+//
+// example:
+//
+//	m := cli.Etcd.NewMutex("locks/report", 10*time.Second)
+//	if err := m.Lock(ctx); err != nil {
+//	  return err
+//	}
+//	defer m.Close()
+//	select {
+//	case <-m.Done(): // 租约丢失,锁已不再有效
+//	case <-work():
+//	}
+type Mutex struct {
+	etcd *Etcd
+	key  string
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	acquiring bool // 正在加锁,加锁过程不持有mu
+	closed    bool
+	session   *concurrency.Session
+	m         *concurrency.Mutex
+}
+
+// NewMutex 创建分布式锁,ttl为租约时间,持有者失联超过ttl后锁自动释放
+func (e *Etcd) NewMutex(key string, ttl time.Duration) *Mutex {
+	return &Mutex{etcd: e, key: key, ttl: ttl}
+}
+
+// Lock 加锁,阻塞直到获得锁或ctx取消
+func (m *Mutex) Lock(ctx context.Context) error {
+	return m.lock(ctx, func(cm *concurrency.Mutex) error {
+		return cm.Lock(ctx)
+	})
+}
+
+// TryLock 尝试加锁,锁已被持有时返回ErrLocked
+func (m *Mutex) TryLock(ctx context.Context) error {
+	return m.lock(ctx, func(cm *concurrency.Mutex) error {
+		return cm.TryLock(ctx)
+	})
+}
+
+func (m *Mutex) lock(ctx context.Context, fn func(cm *concurrency.Mutex) error) error {
+	m.mu.Lock()
+	switch {
+	case m.closed:
+		m.mu.Unlock()
+		return ErrClosed
+	case m.m != nil || m.acquiring:
+		m.mu.Unlock()
+		return errors.New("config: mutex already locked")
+	}
+	m.acquiring = true
+	m.mu.Unlock()
+
+	session, err := m.etcd.newSession(context.Background(), m.ttl)
+	if err == nil {
+		cm := concurrency.NewMutex(session, m.key)
+		if err = fn(cm); err == nil {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.acquiring = false
+			// 加锁期间被关闭,释放刚获得的锁
+			if m.closed {
+				session.Close()
+				return ErrClosed
+			}
+			m.session, m.m = session, cm
+			return nil
+		}
+		session.Close()
+	}
+	m.mu.Lock()
+	m.acquiring = false
+	m.mu.Unlock()
+	return err
+}
+
+// Unlock 解锁并释放租约
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.m == nil {
+		return ErrNotLocked
+	}
+	err := m.m.Unlock(ctx)
+	m.session.Close()
+	m.session, m.m = nil, nil
+	return err
+}
+
+// Close 释放租约,持有的锁随之释放;关闭后不能再加锁
+func (m *Mutex) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	if m.session == nil {
+		return nil
+	}
+	err := m.session.Close()
+	m.session, m.m = nil, nil
+	return err
+}
+
+// Done 租约丢失时关闭,此后锁不再有效;未持有锁时返回nil
+func (m *Mutex) Done() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.session == nil {
+		return nil
+	}
+	return m.session.Done()
+}
+
+// Election 基于ETCD的选主,当选后租约丢失时自动下台
+//
+// example:
+//
+//	el := cli.Etcd.NewElection("elections/cron", 10*time.Second)
+//	for {
+//	  if err := el.Campaign(ctx, hostname); err != nil {
+//	    return err
+//	  }
+//	  runJobs(el.Done()) // 下台时停止
+//	}
+//	defer el.Close()
+type Election struct {
+	etcd   *Etcd
+	prefix string
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	closed   bool
+	session  *concurrency.Session
+	election *concurrency.Election
+	done     chan struct{} // 当前任期结束时关闭
+}
+
+// NewElection 创建选主,同一prefix下的参与者竞选同一个主
+func (e *Etcd) NewElection(prefix string, ttl time.Duration) *Election {
+	return &Election{etcd: e, prefix: prefix, ttl: ttl}
+}
+
+// current 获取可用的会话,租约丢失后重新创建
+func (el *Election) current() (*concurrency.Election, error) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if el.closed {
+		return nil, ErrClosed
+	}
+	if el.session != nil {
+		select {
+		case <-el.session.Done():
+			el.session, el.election = nil, nil
+		default:
+			return el.election, nil
+		}
+	}
+	session, err := el.etcd.newSession(context.Background(), el.ttl)
+	if err != nil {
+		return nil, err
+	}
+	el.session = session
+	el.election = concurrency.NewElection(session, el.prefix)
+	return el.election, nil
+}
+
+// Campaign 竞选,阻塞直到当选或ctx取消,value为当选后公布的值,如实例地址
+func (el *Election) Campaign(ctx context.Context, value string) error {
+	election, err := el.current()
+	if err != nil {
+		return err
+	}
+	if err = election.Campaign(ctx, value); err != nil {
+		return err
+	}
+
+	el.mu.Lock()
+	done := make(chan struct{})
+	el.done = done
+	session := el.session
+	el.mu.Unlock()
+
+	// 租约丢失时自动下台
+	go func() {
+		<-session.Done()
+		el.stepDown(done)
+	}()
+	return nil
+}
+
+// stepDown 结束任期
+func (el *Election) stepDown(done chan struct{}) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if el.done == done {
+		close(done)
+		el.done = nil
+	}
+}
+
+// Resign 主动下台并释放租约,再次Campaign时使用新的租约
+func (el *Election) Resign(ctx context.Context) error {
+	el.mu.Lock()
+	election, session, done := el.election, el.session, el.done
+	el.mu.Unlock()
+	if election == nil || done == nil {
+		return ErrNotLeader
+	}
+	err := election.Resign(ctx)
+	el.stepDown(done)
+
+	el.mu.Lock()
+	if el.session == session {
+		el.session, el.election = nil, nil
+	}
+	el.mu.Unlock()
+	session.Close()
+	return err
+}
+
+// Close 释放租约,在任时随之下台;关闭后不能再竞选
+func (el *Election) Close() error {
+	el.mu.Lock()
+	el.closed = true
+	session, done := el.session, el.done
+	el.session, el.election = nil, nil
+	el.mu.Unlock()
+	if session == nil {
+		return nil
+	}
+	err := session.Close()
+	if done != nil {
+		el.stepDown(done)
+	}
+	return err
+}
+
+// IsLeader 当前是否在任
+func (el *Election) IsLeader() bool {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	return el.done != nil
+}
+
+// Done 当前任期结束时关闭,包括主动下台与租约丢失;未当选时返回nil
+func (el *Election) Done() <-chan struct{} {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if el.done == nil {
+		return nil
+	}
+	return el.done
+}
+
+// Leader 当前主公布的值,没有主时返回ErrNotLeader
+func (el *Election) Leader(ctx context.Context) (string, error) {
+	election, err := el.current()
+	if err != nil {
+		return "", err
+	}
+	resp, err := election.Leader(ctx)
+	if errors.Is(err, concurrency.ErrElectionNoLeader) {
+		return "", ErrNotLeader
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// Observe 监听主的变化,返回每次换主后主公布的值,ctx取消时关闭
+func (el *Election) Observe(ctx context.Context) (<-chan string, error) {
+	election, err := el.current()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		for resp := range election.Observe(ctx) {
+			if len(resp.Kvs) == 0 {
+				continue
+			}
+			select {
+			case ch <- string(resp.Kvs[0].Value):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudneedle/gokit/tools"
+)
+
+// testEtcd 连接本地ETCD,不可用时跳过测试
+func testEtcd(t *testing.T) *Etcd {
+	t.Helper()
+	e, err := newEtcdClient("127.0.0.1:2379", time.Second, nil)
+	if err != nil {
+		t.Skip("etcd not available:", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = e.Status(ctx); err != nil {
+		e.Close()
+		t.Skip("etcd not available:", err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+func TestMutex(t *testing.T) {
+	e := testEtcd(t)
+	key := "test/locks/" + tools.GetUUID()
+	ctx := context.Background()
+
+	a, b := e.NewMutex(key, 5*time.Second), e.NewMutex(key, 5*time.Second)
+	if err := a.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.TryLock(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("try lock held mutex = %v", err)
+	}
+
+	// 阻塞加锁期间不影响对同一个Mutex的其他调用
+	locked := make(chan error, 1)
+	go func() {
+		locked <- b.Lock(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Unlock(ctx)
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrNotLocked) {
+			t.Fatalf("unlock while acquiring = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("unlock blocked behind lock")
+	}
+
+	if err := a.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("lock not acquired after unlock")
+	}
+
+	// Close释放租约,锁随之释放
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Lock(ctx); !errors.Is(err, ErrClosed) {
+		t.Fatalf("lock after close = %v", err)
+	}
+	c := e.NewMutex(key, 5*time.Second)
+	defer c.Close()
+	if err := c.TryLock(ctx); err != nil {
+		t.Fatalf("try lock after close = %v", err)
+	}
+}
+
+func TestElection(t *testing.T) {
+	e := testEtcd(t)
+	prefix := "test/elections/" + tools.GetUUID()
+	ctx := context.Background()
+
+	a, b := e.NewElection(prefix, 5*time.Second), e.NewElection(prefix, 5*time.Second)
+	defer b.Close()
+	if err := a.Campaign(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if leader, err := b.Leader(ctx); err != nil || leader != "a" {
+		t.Fatalf("leader = %q, %v", leader, err)
+	}
+	if err := a.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if a.IsLeader() {
+		t.Fatal("still leader after resign")
+	}
+
+	// 再次竞选使用新的租约
+	if err := a.Campaign(ctx, "a2"); err != nil {
+		t.Fatal(err)
+	}
+	done := a.Done()
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("term not ended after close")
+	}
+	if err := a.Campaign(ctx, "a3"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("campaign after close = %v", err)
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	if err := b.Campaign(cctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if leader, err := b.Leader(ctx); err != nil || leader != "b" {
+		t.Fatalf("leader = %q, %v", leader, err)
+	}
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Memory 内存配置,用于单元测试替换ETCD
+type Memory struct {
+	mu       sync.RWMutex
+	kvs      map[string]string
+	rev      int64            // 当前版本,每次写入加一
+	revs     map[string]int64 // 每个key最后修改的版本
+	watchers map[int]func(ev Event)
+	nextID   int
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewMemory 创建内存配置,kvs为初始配置
+func NewMemory(kvs map[string]string) *Memory {
+	m := &Memory{
+		kvs:      make(map[string]string, len(kvs)),
+		revs:     make(map[string]int64, len(kvs)),
+		watchers: make(map[int]func(ev Event)),
+		done:     make(chan struct{}),
+	}
+	ops := make([]Op, 0, len(kvs))
+	for k, v := range kvs {
+		ops = append(ops, PutOp(k, v))
+	}
+	m.apply(ops)
+	return m
+}
+
+// Get 获取配置
+func (m *Memory) Get(key string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	// 由调用层判断是否存在
+	return m.kvs[key], nil
+}
+
+// GetPrefix 获取前缀配置
+func (m *Memory) GetPrefix(prefix string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var res map[string]string
+	for k, v := range m.kvs {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if res == nil {
+			res = make(map[string]string)
+		}
+		res[k] = v
+	}
+	// 由调用层判断是否存在
+	return res, nil
+}
+
+// Watch 监听配置
+func (m *Memory) Watch(key string, callback func(key string, value string)) error {
+	return m.watch(context.Background(), func(ev Event) {
+		if ev.Key == key {
+			callback(ev.Key, ev.Value)
+		}
+	})
+}
+
+// WatchPrefix 监听前缀配置
+func (m *Memory) WatchPrefix(prefix string, callback func(map[string]string)) error {
+	return m.watch(context.Background(), func(ev Event) {
+		if strings.HasPrefix(ev.Key, prefix) {
+			callback(map[string]string{ev.Key: ev.Value})
+		}
+	})
+}
+
+// WatchPrefixContext 监听前缀配置,阻塞直到ctx取消或关闭,此时返回nil
+func (m *Memory) WatchPrefixContext(ctx context.Context, prefix string, callback func(evs []Event)) error {
+	return m.watch(ctx, func(ev Event) {
+		if strings.HasPrefix(ev.Key, prefix) {
+			callback([]Event{ev})
+		}
+	})
+}
+
+// watch 注册监听并阻塞直到ctx取消或关闭
+func (m *Memory) watch(ctx context.Context, fn func(ev Event)) error {
+	m.mu.Lock()
+	id := m.nextID
+	m.nextID++
+	m.watchers[id] = fn
+	m.mu.Unlock()
+
+	select {
+	case <-m.done:
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	delete(m.watchers, id)
+	m.mu.Unlock()
+	return nil
+}
+
+// notify 通知所有监听
+func (m *Memory) notify(ev Event) {
+	m.mu.RLock()
+	fns := make([]func(ev Event), 0, len(m.watchers))
+	for _, fn := range m.watchers {
+		fns = append(fns, fn)
+	}
+	m.mu.RUnlock()
+	for _, fn := range fns {
+		fn(ev)
+	}
+}
+
+// Put 设置配置
+func (m *Memory) Put(key, value string) error {
+	m.write(nil, PutOp(key, value))
+	return nil
+}
+
+// Delete 删除配置
+func (m *Memory) Delete(key string) error {
+	m.write(nil, DeleteOp(key))
+	return nil
+}
+
+// PutMany 原子地设置多个配置
+func (m *Memory) PutMany(kvs map[string]string) error {
+	ops := make([]Op, 0, len(kvs))
+	for k, v := range kvs {
+		ops = append(ops, PutOp(k, v))
+	}
+	m.write(nil, ops...)
+	return nil
+}
+
+// GetRevision 获取配置及其最后修改的版本,不存在时版本为0
+func (m *Memory) GetRevision(key string) (string, int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.kvs[key], m.revs[key], nil
+}
+
+// Txn 所有条件满足时执行全部操作,否则不执行任何操作并返回*ConflictError
+func (m *Memory) Txn(_ context.Context, cmps []Compare, ops ...Op) error {
+	return m.write(cmps, ops...)
+}
+
+// PutIfAbsent key不存在时设置,已存在时返回*ConflictError
+func (m *Memory) PutIfAbsent(key, value string) error {
+	return m.write([]Compare{Absent(key)}, PutOp(key, value))
+}
+
+// CompareAndSwap key的值等于old时设置为new,否则返回*ConflictError
+func (m *Memory) CompareAndSwap(key, old, new string) error {
+	return m.write([]Compare{ValueEquals(key, old)}, PutOp(key, new))
+}
+
+// write 在锁内比较并执行操作,完成后通知监听
+func (m *Memory) write(cmps []Compare, ops ...Op) error {
+	m.mu.Lock()
+	for _, c := range cmps {
+		v, exists := m.kvs[c.Key]
+		if !c.match(v, m.revs[c.Key], exists) {
+			m.mu.Unlock()
+			return c.conflict(v, m.revs[c.Key], exists)
+		}
+	}
+	changes := m.apply(ops)
+	rev := m.rev
+	m.mu.Unlock()
+
+	for _, op := range changes {
+		ev := Event{Type: EventPut, Key: op.Key, Value: op.Value, Revision: rev}
+		if op.Type == OpDelete {
+			ev.Type, ev.Value = EventDelete, ""
+		}
+		m.notify(ev)
+	}
+	return nil
+}
+
+// apply 执行操作并更新版本,返回实际发生的变化,调用方需持有写锁
+func (m *Memory) apply(ops []Op) []Op {
+	if len(ops) == 0 {
+		return nil
+	}
+	m.rev++
+	changes := make([]Op, 0, len(ops))
+	for _, op := range ops {
+		switch op.Type {
+		case OpPut:
+			m.kvs[op.Key] = op.Value
+			m.revs[op.Key] = m.rev
+			changes = append(changes, op)
+		case OpDelete:
+			if _, ok := m.kvs[op.Key]; !ok {
+				continue
+			}
+			delete(m.kvs, op.Key)
+			delete(m.revs, op.Key)
+			changes = append(changes, op)
+		}
+	}
+	return changes
+}
+
+// Close 关闭内存配置,结束所有监听
+func (m *Memory) Close() error {
+	m.once.Do(func() {
+		close(m.done)
+	})
+	return nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	cli, err := New(WithProvider(NewMemory(map[string]string{
+		"admin/server_host": ":8081",
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	changed := make(chan map[string]string, 1)
+	go cli.WatchPrefix("admin/", func(m map[string]string) {
+		changed <- m
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	if err = cli.Put("admin/log_path", "app.log"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-changed:
+		if m["admin/log_path"] != "app.log" {
+			t.Fatalf("watch admin/ = %v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch admin/ timeout")
+	}
+
+	m, err := cli.GetPrefix("admin/")
+	if err != nil || len(m) != 2 {
+		t.Fatalf("get prefix admin/ = %v, %v", m, err)
+	}
+	if err = cli.Delete("admin/server_host"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := cli.Get("admin/server_host"); v != "" {
+		t.Fatalf("get deleted admin/server_host = %q", v)
+	}
+}
+
+func TestMemory_Txn(t *testing.T) {
+	cli, _ := New(WithProvider(NewMemory(nil)))
+
+	if err := cli.PutIfAbsent("admin/leader", "a"); err != nil {
+		t.Fatal(err)
+	}
+	var conflict *ConflictError
+	if err := cli.PutIfAbsent("admin/leader", "b"); !errors.As(err, &conflict) || conflict.Actual != "a" {
+		t.Fatalf("put if absent on existing key = %v", err)
+	}
+	if err := cli.CompareAndSwap("admin/leader", "b", "c"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("compare and swap with stale value = %v", err)
+	}
+	if err := cli.CompareAndSwap("admin/leader", "a", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, rev, err := cli.GetRevision("admin/leader")
+	if err != nil || rev == 0 {
+		t.Fatalf("get revision = %d, %v", rev, err)
+	}
+	err = cli.Txn(context.Background(),
+		[]Compare{ModRevisionEquals("admin/leader", rev), Absent("admin/version")},
+		PutOp("admin/version", "v2"), DeleteOp("admin/leader"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cli.Txn(context.Background(), []Compare{ModRevisionEquals("admin/version", rev)}, DeleteOp("admin/version")); !errors.Is(err, ErrConflict) {
+		t.Fatalf("txn with stale revision = %v", err)
+	}
+	if v, _ := cli.Get("admin/version"); v != "v2" {
+		t.Fatalf("get admin/version = %q", v)
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"context"
+	"fmt"
+)
+
+// Provider 配置后端,ETCD、YAML与内存实现均满足该接口
+type Provider interface {
+	// Get 获取配置,不存在时返回空字符串
+	Get(key string) (string, error)
+	// GetPrefix 获取前缀配置,不存在时返回nil
+	GetPrefix(prefix string) (map[string]string, error)
+	// Watch 监听配置,阻塞直到后端关闭
+	Watch(key string, callback func(key string, value string)) error
+	// WatchPrefix 监听前缀配置,阻塞直到后端关闭
+	WatchPrefix(prefix string, callback func(map[string]string)) error
+	// Put 设置配置
+	Put(key, value string) error
+	// Delete 删除配置
+	Delete(key string) error
+	// Close 关闭后端
+	Close() error
+}
+
+// contextWatcher 支持取消监听的配置后端
+type contextWatcher interface {
+	WatchPrefixContext(ctx context.Context, prefix string, callback func(evs []Event)) error
+}
+
+// batchPutter 支持原子批量写入的配置后端
+type batchPutter interface {
+	PutMany(kvs map[string]string) error
+}
+
+// putMany 原子批量写入,后端不支持时返回错误
+func putMany(p Provider, kvs map[string]string) error {
+	b, ok := p.(batchPutter)
+	if !ok {
+		return fmt.Errorf("config: provider %T does not support PutMany", p)
+	}
+	return b.PutMany(kvs)
+}
+
+var (
+	_ contextWatcher = (*Etcd)(nil)
+	_ contextWatcher = (*Memory)(nil)
+
+	_ Provider = (*Etcd)(nil)
+	_ Provider = (*Yaml)(nil)
+	_ Provider = (*Memory)(nil)
+	_ Provider = (*Env)(nil)
+	_ Provider = (*Flags)(nil)
+	_ Provider = (*Layered)(nil)
+)
@@ -0,0 +1,422 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Schema 配置约束,按注册前缀下的相对key校验单个配置值
+type Schema interface {
+	Validate(key, value string) error
+}
+
+// SchemaError 配置值不符合约束
+type SchemaError struct {
+	Key   string // 完整的配置key
+	Value string // 配置值
+	Err   error  // 具体原因
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("config: %s=%q does not match schema: %v", e.Key, e.Value, e.Err)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+// ErrUnknownKey key不在约束定义中
+var ErrUnknownKey = errors.New("unknown key")
+
+// SchemaRegistry 按key前缀注册的配置约束,匹配最长的前缀
+type SchemaRegistry struct {
+	mu      sync.RWMutex
+	entries []schemaEntry
+}
+
+type schemaEntry struct {
+	prefix string
+	schema Schema
+}
+
+// NewSchemaRegistry 创建约束注册表
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{}
+}
+
+// Register 注册前缀的约束,如 Register("admin", StructSchema(ServerConfig{}))
+func (r *SchemaRegistry) Register(prefix string, s Schema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, schemaEntry{prefix: strings.TrimSuffix(prefix, "/"), schema: s})
+	sort.SliceStable(r.entries, func(i, j int) bool {
+		return len(r.entries[i].prefix) > len(r.entries[j].prefix)
+	})
+}
+
+// Validate 校验配置值,没有匹配的约束时返回nil,不符合时返回*SchemaError
+func (r *SchemaRegistry) Validate(key, value string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, e := range r.entries {
+		rel, ok := relKey(e.prefix, key)
+		if !ok {
+			continue
+		}
+		if err := e.schema.Validate(rel, value); err != nil {
+			return &SchemaError{Key: key, Value: value, Err: err}
+		}
+		return nil
+	}
+	return nil
+}
+
+// relKey key相对于前缀的部分
+func relKey(prefix, key string) (string, bool) {
+	if prefix == "" {
+		return strings.TrimPrefix(key, "/"), true
+	}
+	if !strings.HasPrefix(key, prefix+"/") {
+		return "", false
+	}
+	return key[len(prefix)+1:], true
+}
+
+// WithSchemas 设置约束注册表,Put与PutMany写入前校验,Get与GetPrefix读取后校验非空值
+func WithSchemas(r *SchemaRegistry) ClientOption {
+	return func(c *Client) {
+		c.schemas = r
+	}
+}
+
+// check 校验配置值,未设置约束注册表时直接通过
+func (c *Client) check(key, value string) error {
+	if c.schemas == nil {
+		return nil
+	}
+	return c.schemas.Validate(key, value)
+}
+
+// checkRead 读取后校验,Get无法区分空值与不存在的key,空值都视为未设置,不校验
+func (c *Client) checkRead(key, value string) error {
+	if value == "" {
+		return nil
+	}
+	return c.check(key, value)
+}
+
+// structSchema 以结构体定义的约束,key规则同Client.Unmarshal,值需能解析为字段类型并满足validate标签
+type structSchema struct {
+	t reflect.Type
+}
+
+// StructSchema 以结构体定义约束
+//
+// example:
+//
+//	type ServerConfig struct {
+//	  Host string `config:"server_host" validate:"required,hostname_port"`
+//	}
+//	registry.Register("admin", config.StructSchema(ServerConfig{}))
+func StructSchema(v any) Schema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return &structSchema{t: t}
+}
+
+func (s *structSchema) Validate(key, value string) error {
+	t, tag := s.t, ""
+	for _, seg := range strings.Split(key, "/") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch {
+		case isScalar(t):
+			return ErrUnknownKey
+		case t.Kind() == reflect.Struct:
+			f, ok := fieldByKey(t, seg)
+			if !ok {
+				return ErrUnknownKey
+			}
+			t, tag = f.Type, f.Tag.Get("validate")
+		case t.Kind() == reflect.Slice:
+			if _, err := strconv.Atoi(seg); err != nil {
+				return ErrUnknownKey
+			}
+			t, tag = t.Elem(), ""
+		case t.Kind() == reflect.Map:
+			t, tag = t.Elem(), ""
+		default:
+			return ErrUnknownKey
+		}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	v := reflect.New(t).Elem()
+	switch {
+	case isScalar(t):
+		if value != "" {
+			if err := setScalar(v, value); err != nil {
+				return err
+			}
+		}
+	case t.Kind() == reflect.Slice && isScalar(t.Elem()):
+		if err := bindSlice(map[string]string{}, key, value, value != "", v); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("key refers to %s, not a value", t)
+	}
+	if tag == "" {
+		return nil
+	}
+	return validate.Var(v.Interface(), tag)
+}
+
+// fieldByKey 按配置key查找字段,包括未指定key的嵌入结构体中的字段
+func fieldByKey(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, ok := f.Tag.Lookup("config")
+		if key == "-" {
+			continue
+		}
+		if f.Anonymous && !ok && f.Type.Kind() == reflect.Struct {
+			if sf, ok := fieldByKey(f.Type, name); ok {
+				return sf, true
+			}
+			continue
+		}
+		if key == "" {
+			key = snakeCase(f.Name)
+		}
+		if key == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// jsonSchema JSON Schema的常用子集:
+// type、enum、pattern、minLength、maxLength、minimum、maximum、
+// properties、required、additionalProperties(布尔值)、items、minItems、maxItems
+type jsonSchema struct {
+	Type                 any                    `json:"type"`
+	Enum                 []any                  `json:"enum"`
+	Pattern              string                 `json:"pattern"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+
+	re *regexp.Regexp
+}
+
+// JSONSchema 以JSON Schema定义约束,前缀下的key对应properties的层级,数字段对应items
+//
+// 值按声明的type解析:string直接使用,number、integer、boolean按字面量解析,object、array按JSON解析
+func JSONSchema(doc []byte) (Schema, error) {
+	s := new(jsonSchema)
+	if err := json.Unmarshal(doc, s); err != nil {
+		return nil, fmt.Errorf("config: parse json schema: %w", err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *jsonSchema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("config: json schema pattern: %w", err)
+		}
+		s.re = re
+	}
+	for _, p := range s.Properties {
+		if err := p.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+func (s *jsonSchema) Validate(key, value string) error {
+	node := s
+	for _, seg := range strings.Split(key, "/") {
+		if p, ok := node.Properties[seg]; ok {
+			node = p
+			continue
+		}
+		if _, err := strconv.Atoi(seg); err == nil && node.Items != nil {
+			node = node.Items
+			continue
+		}
+		if node.AdditionalProperties != nil && !*node.AdditionalProperties {
+			return ErrUnknownKey
+		}
+		// 未定义的key不做约束
+		return nil
+	}
+	instance, err := node.decode(value)
+	if err != nil {
+		return err
+	}
+	return node.check(instance)
+}
+
+// decode 按声明的类型解析配置值
+func (s *jsonSchema) decode(value string) (any, error) {
+	switch {
+	case s.is("string"):
+		return value, nil
+	case s.is("integer"), s.is("number"):
+		return strconv.ParseFloat(value, 64)
+	case s.is("boolean"):
+		return strconv.ParseBool(value)
+	case s.is("object"), s.is("array"):
+		var v any
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return value, nil
+	}
+	return v, nil
+}
+
+// is 是否声明了该类型
+func (s *jsonSchema) is(typ string) bool {
+	switch t := s.Type.(type) {
+	case string:
+		return t == typ
+	case []any:
+		for _, v := range t {
+			if v == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// check 校验解析后的值
+func (s *jsonSchema) check(v any) error {
+	if s.Type != nil && !s.is(jsonType(v)) && !(jsonType(v) == "integer" && s.is("number")) {
+		return fmt.Errorf("want type %v, got %s", s.Type, jsonType(v))
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("value not in enum %v", s.Enum)
+		}
+	}
+	switch x := v.(type) {
+	case string:
+		n := len([]rune(x))
+		if s.MinLength != nil && n < *s.MinLength {
+			return fmt.Errorf("length %d < minLength %d", n, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("length %d > maxLength %d", n, *s.MaxLength)
+		}
+		if s.re != nil && !s.re.MatchString(x) {
+			return fmt.Errorf("does not match pattern %q", s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && x < *s.Minimum {
+			return fmt.Errorf("%v < minimum %v", x, *s.Minimum)
+		}
+		if s.Maximum != nil && x > *s.Maximum {
+			return fmt.Errorf("%v > maximum %v", x, *s.Maximum)
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := x[name]; !ok {
+				return fmt.Errorf("missing required property %q", name)
+			}
+		}
+		for name, pv := range x {
+			p, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: %w", name, ErrUnknownKey)
+				}
+				continue
+			}
+			if err := p.check(pv); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	case []any:
+		if s.MinItems != nil && len(x) < *s.MinItems {
+			return fmt.Errorf("%d items < minItems %d", len(x), *s.MinItems)
+		}
+		if s.MaxItems != nil && len(x) > *s.MaxItems {
+			return fmt.Errorf("%d items > maxItems %d", len(x), *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, iv := range x {
+				if err := s.Items.check(iv); err != nil {
+					return fmt.Errorf("%d: %w", i, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonType 值对应的JSON Schema类型
+func jsonType(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if x == float64(int64(x)) {
+			return "integer"
+		}
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return "unknown"
+}
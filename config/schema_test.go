@@ -0,0 +1,56 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSchemaRegistry(t *testing.T) {
+	registry := NewSchemaRegistry()
+	registry.Register("admin", StructSchema(testServer{}))
+	js, err := JSONSchema([]byte(`{
+		"properties": {
+			"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+			"mode": {"type": "string", "enum": ["debug", "release"]}
+		},
+		"additionalProperties": false
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Register("web", js)
+
+	mem := NewMemory(map[string]string{"admin/timeout": "abc", "admin/db/host": ""})
+	cli, _ := New(WithProvider(mem), WithSchemas(registry))
+
+	var schemaErr *SchemaError
+	if err = cli.Put("admin/server_host", ""); !errors.As(err, &schemaErr) {
+		t.Fatalf("put empty required server_host = %v", err)
+	}
+	if err = cli.Put("admin/db/port", "8081"); err != nil {
+		t.Fatal(err)
+	}
+	if err = cli.Put("admin/unknown", "1"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("put unknown key = %v", err)
+	}
+	if err = cli.PutMany(map[string]string{"web/port": "8081", "web/mode": "test"}); err == nil {
+		t.Fatal("put many with invalid mode should fail")
+	}
+	if v, _ := mem.Get("web/port"); v != "" {
+		t.Fatalf("put many should not write partially, web/port = %q", v)
+	}
+	if err = cli.PutMany(map[string]string{"web/port": "8081", "web/mode": "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Get("admin/timeout"); !errors.As(err, &schemaErr) {
+		t.Fatalf("get drifted admin/timeout = %v", err)
+	}
+
+	// 读取时空值视为未设置,Get与GetPrefix一致
+	if v, err := cli.Get("admin/db/host"); err != nil || v != "" {
+		t.Fatalf("get empty admin/db/host = %q, %v", v, err)
+	}
+	if _, err = cli.GetPrefix("admin/db"); err != nil {
+		t.Fatalf("get prefix with empty admin/db/host = %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// KeyringEnv 默认的密钥环环境变量
+const KeyringEnv = "GOKIT_CONFIG_KEYS"
+
+// 加密值的前缀,完整格式为 enc:v2:<密钥ID>:<base64(nonce+密文)>,以配置key作为附加认证数据,密文复制到其他key下无法解密
+const secretPrefix = "enc:v2:"
+
+var (
+	// ErrNoKeyring 读取到加密值但客户端未设置密钥环
+	ErrNoKeyring = errors.New("config: secret value found but no keyring configured")
+	// ErrDecrypt 密钥环中没有能解密的密钥
+	ErrDecrypt = errors.New("config: unable to decrypt secret value")
+)
+
+// Keyring 密钥环,第一个密钥用于加密,所有密钥都会用于解密以支持密钥轮换
+type Keyring struct {
+	ids  []string
+	keys map[string]cipher.AEAD
+}
+
+// NewKeyring 创建密钥环,ids与keys一一对应,密钥长度为16、24或32字节
+func NewKeyring(ids []string, keys [][]byte) (*Keyring, error) {
+	if len(ids) == 0 || len(ids) != len(keys) {
+		return nil, fmt.Errorf("config: keyring needs matching ids and keys")
+	}
+	k := &Keyring{keys: make(map[string]cipher.AEAD, len(ids))}
+	for i, id := range ids {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("config: invalid key id %q", id)
+		}
+		if _, ok := k.keys[id]; ok {
+			return nil, fmt.Errorf("config: duplicate key id %q", id)
+		}
+		block, err := aes.NewCipher(keys[i])
+		if err != nil {
+			return nil, fmt.Errorf("config: key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.ids = append(k.ids, id)
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+// ParseKeyring 解析密钥环,每项为 <密钥ID>:<base64密钥>,以换行或逗号分隔,第一项为当前密钥,#开头的行为注释
+func ParseKeyring(s string) (*Keyring, error) {
+	var (
+		ids  []string
+		keys [][]byte
+	)
+	sc := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(s, ",", "\n")))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, enc, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("config: invalid keyring entry, want <id>:<base64 key>")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(enc))
+		if err != nil {
+			return nil, fmt.Errorf("config: key %s: %w", id, err)
+		}
+		ids = append(ids, strings.TrimSpace(id))
+		keys = append(keys, key)
+	}
+	return NewKeyring(ids, keys)
+}
+
+// LoadKeyring 从密钥文件加载密钥环
+func LoadKeyring(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyring(string(b))
+}
+
+// LoadKeyringEnv 从环境变量加载密钥环,name为空时使用KeyringEnv
+func LoadKeyringEnv(name string) (*Keyring, error) {
+	if name == "" {
+		name = KeyringEnv
+	}
+	s := os.Getenv(name)
+	if s == "" {
+		return nil, fmt.Errorf("config: env %s is empty", name)
+	}
+	return ParseKeyring(s)
+}
+
+// GenerateKey 生成一个base64编码的AES-256密钥
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Seal 使用当前密钥加密,key作为附加认证数据,解密时必须使用相同的key
+func (k *Keyring) Seal(key, plain string) (string, error) {
+	id := k.ids[0]
+	aead := k.keys[id]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), secretAAD(key))
+	return secretPrefix + id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open 解密key的加密值,优先使用密文中记录的密钥,失败后依次尝试其他密钥
+func (k *Keyring) Open(key, value string) (string, error) {
+	id, sealed, err := parseSecret(value)
+	if err != nil {
+		return "", err
+	}
+	aad := secretAAD(key)
+	if aead, ok := k.keys[id]; ok {
+		if plain, err := open(aead, sealed, aad); err == nil {
+			return plain, nil
+		}
+	}
+	for _, other := range k.ids {
+		if other == id {
+			continue
+		}
+		if plain, err := open(k.keys[other], sealed, aad); err == nil {
+			return plain, nil
+		}
+	}
+	return "", ErrDecrypt
+}
+
+// Current 值是否已使用当前密钥加密,轮换密钥后可据此判断是否需要重新加密
+func (k *Keyring) Current(value string) bool {
+	id, _, err := parseSecret(value)
+	return err == nil && id == k.ids[0]
+}
+
+// secretAAD 附加认证数据,使用规范化的key,YAML等后端中 admin.db 与 admin/db 视为同一个key
+func secretAAD(key string) []byte {
+	return []byte(normalizeKey(key))
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) (string, error) {
+	if len(sealed) < aead.NonceSize() {
+		return "", ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func parseSecret(value string) (id string, sealed []byte, err error) {
+	if !IsSecret(value) {
+		return "", nil, fmt.Errorf("config: not a secret value")
+	}
+	id, enc, ok := strings.Cut(value[len(secretPrefix):], ":")
+	if !ok {
+		return "", nil, ErrDecrypt
+	}
+	sealed, err = base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", nil, ErrDecrypt
+	}
+	return id, sealed, nil
+}
+
+// IsSecret 值是否为加密值
+func IsSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// WithKeyring 设置密钥环,设置后可以使用PutSecret写入加密值,读取时自动解密
+func WithKeyring(k *Keyring) ClientOption {
+	return func(c *Client) {
+		c.keyring = k
+	}
+}
+
+// PutSecret 加密后写入配置
+func (c *Client) PutSecret(key, value string) error {
+	if c.keyring == nil {
+		return ErrNoKeyring
+	}
+	// 约束校验明文
+	if err := c.check(key, value); err != nil {
+		return err
+	}
+	sealed, err := c.keyring.Seal(key, value)
+	if err != nil {
+		return err
+	}
+	return c.p.Put(key, sealed)
+}
+
+// Reseal 将为from加密的值重新加密为to的值,加密值绑定key,复制到其他key下时需要重新加密
+func (c *Client) Reseal(from, to, value string) (string, error) {
+	plain, err := c.reveal(from, value)
+	if err != nil {
+		return "", err
+	}
+	return c.keyring.Seal(to, plain)
+}
+
+// RotateSecrets 使用当前密钥重新加密前缀下的加密值,返回重新加密的数量
+func (c *Client) RotateSecrets(prefix string) (int, error) {
+	if c.keyring == nil {
+		return 0, ErrNoKeyring
+	}
+	kvs, err := c.p.GetPrefix(prefix)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for k, v := range kvs {
+		if !IsSecret(v) || c.keyring.Current(v) {
+			continue
+		}
+		plain, err := c.keyring.Open(k, v)
+		if err != nil {
+			return n, fmt.Errorf("config: %s: %w", k, err)
+		}
+		if err = c.PutSecret(k, plain); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// reveal 解密加密值,普通值原样返回
+func (c *Client) reveal(key, value string) (string, error) {
+	if !IsSecret(value) {
+		return value, nil
+	}
+	if c.keyring == nil {
+		return "", fmt.Errorf("config: %s: %w", key, ErrNoKeyring)
+	}
+	plain, err := c.keyring.Open(key, value)
+	if err != nil {
+		return "", fmt.Errorf("config: %s: %w", key, err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_PutSecret(t *testing.T) {
+	oldKey, _ := GenerateKey()
+	newKey, _ := GenerateKey()
+	oldRing, err := ParseKeyring("k1:" + oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemory(nil)
+	cli, _ := New(WithProvider(mem), WithKeyring(oldRing))
+	if err = cli.PutSecret("admin/jwt_secret", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := mem.Get("admin/jwt_secret"); !strings.HasPrefix(raw, "enc:v2:k1:") {
+		t.Fatalf("stored value = %q", raw)
+	}
+
+	// 轮换后旧密钥仍可解密
+	ring, err := ParseKeyring("k2:" + newKey + ",k1:" + oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli, _ = New(WithProvider(mem), WithKeyring(ring))
+	if v, err := cli.Get("admin/jwt_secret"); err != nil || v != "s3cret" {
+		t.Fatalf("get admin/jwt_secret = %q, %v", v, err)
+	}
+	if n, err := cli.RotateSecrets("admin/"); err != nil || n != 1 {
+		t.Fatalf("rotate = %d, %v", n, err)
+	}
+	if raw, _ := mem.Get("admin/jwt_secret"); !strings.HasPrefix(raw, "enc:v2:k2:") {
+		t.Fatalf("rotated value = %q", raw)
+	}
+
+	cli, _ = New(WithProvider(mem))
+	if _, err = cli.Get("admin/jwt_secret"); err == nil {
+		t.Fatal("get secret without keyring should fail")
+	}
+}
+
+func TestClient_SecretBoundToKey(t *testing.T) {
+	key, _ := GenerateKey()
+	ring, err := ParseKeyring("k1:" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemory(nil)
+	cli, _ := New(WithProvider(mem), WithKeyring(ring))
+	if err = cli.PutSecret("admin/db_password", "p4ss"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 密文复制到其他key下无法解密
+	raw, _ := mem.Get("admin/db_password")
+	_ = mem.Put("admin/jwt_secret", raw)
+	if v, err := cli.Get("admin/jwt_secret"); err == nil {
+		t.Fatalf("copied secret decrypted as %q", v)
+	}
+
+	// 监听时跳过无法解密的值,不回调密文
+	changed := make(chan map[string]string, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cli.WatchPrefixContext(ctx, "admin/", func(m map[string]string) {
+		changed <- m
+	})
+	time.Sleep(50 * time.Millisecond)
+	_ = mem.Put("admin/jwt_secret", raw)
+	if err = cli.PutSecret("admin/db_password", "n3w"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-changed:
+		if len(m) != 1 || m["admin/db_password"] != "n3w" {
+			t.Fatalf("watch = %v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch timeout")
+	}
+}
+
+func TestClient_CompareAndSwapSecret(t *testing.T) {
+	key, _ := GenerateKey()
+	ring, err := ParseKeyring("k1:" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemory(nil)
+	cli, _ := New(WithProvider(mem), WithKeyring(ring))
+	if err = cli.PutSecret("admin/db_password", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cli.CompareAndSwap("admin/db_password", "wrong", "new"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("swap with wrong old = %v", err)
+	}
+	if err = cli.CompareAndSwap("admin/db_password", "old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := mem.Get("admin/db_password"); !IsSecret(raw) {
+		t.Fatalf("swapped value stored as plaintext %q", raw)
+	}
+	if v, err := cli.Get("admin/db_password"); err != nil || v != "new" {
+		t.Fatalf("get admin/db_password = %q, %v", v, err)
+	}
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// CompareTarget 事务比较的对象
+type CompareTarget int
+
+const (
+	CompareValue       CompareTarget = iota // 比较值,key不存在时比较失败
+	CompareModRevision                      // 比较最后修改的版本,key不存在时版本为0
+)
+
+// Compare 事务的比较条件
+type Compare struct {
+	Key      string
+	Target   CompareTarget
+	Value    string // CompareValue时期望的值
+	Revision int64  // CompareModRevision时期望的版本
+}
+
+// ValueEquals key的值等于value
+func ValueEquals(key, value string) Compare {
+	return Compare{Key: key, Target: CompareValue, Value: value}
+}
+
+// ModRevisionEquals key最后修改的版本等于rev
+func ModRevisionEquals(key string, rev int64) Compare {
+	return Compare{Key: key, Target: CompareModRevision, Revision: rev}
+}
+
+// Absent key不存在
+func Absent(key string) Compare {
+	return ModRevisionEquals(key, 0)
+}
+
+// match 是否满足比较条件
+func (c Compare) match(value string, rev int64, exists bool) bool {
+	switch c.Target {
+	case CompareValue:
+		return exists && value == c.Value
+	case CompareModRevision:
+		return rev == c.Revision
+	}
+	return false
+}
+
+// conflict 比较失败时的错误
+func (c Compare) conflict(value string, rev int64, exists bool) *ConflictError {
+	e := &ConflictError{Key: c.Key}
+	switch c.Target {
+	case CompareValue:
+		e.Expected, e.Actual = c.Value, value
+		if !exists {
+			e.Actual = "<absent>"
+		}
+	case CompareModRevision:
+		if c.Revision == 0 {
+			e.Expected, e.Actual = "<absent>", value
+			break
+		}
+		e.Expected, e.Actual = "revision "+strconv.FormatInt(c.Revision, 10), "revision "+strconv.FormatInt(rev, 10)
+	}
+	return e
+}
+
+// OpType 事务操作类型
+type OpType int
+
+const (
+	OpPut    OpType = iota // 设置
+	OpDelete               // 删除
+)
+
+// Op 事务操作
+type Op struct {
+	Type  OpType
+	Key   string
+	Value string
+}
+
+// PutOp 设置key
+func PutOp(key, value string) Op {
+	return Op{Type: OpPut, Key: key, Value: value}
+}
+
+// DeleteOp 删除key
+func DeleteOp(key string) Op {
+	return Op{Type: OpDelete, Key: key}
+}
+
+// ErrConflict 事务比较失败,可以用errors.Is判断
+var ErrConflict = errors.New("config: conflict")
+
+// ConflictError 事务比较失败,记录第一个不满足的条件
+type ConflictError struct {
+	Key      string
+	Expected string
+	Actual   string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("config: conflict on %s: expected %s, got %s", e.Key, e.Expected, e.Actual)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Transactional 支持事务的配置后端,ETCD、YAML与内存实现均满足该接口
+type Transactional interface {
+	// Txn 所有条件满足时执行全部操作,否则不执行任何操作并返回*ConflictError
+	Txn(ctx context.Context, cmps []Compare, ops ...Op) error
+	// GetRevision 获取配置及其最后修改的版本,不存在时版本为0
+	GetRevision(key string) (value string, rev int64, err error)
+}
+
+var (
+	_ Transactional = (*Etcd)(nil)
+	_ Transactional = (*Yaml)(nil)
+	_ Transactional = (*Memory)(nil)
+)
+
+// transactional 当前后端的事务实现
+func (c *Client) transactional() (Transactional, error) {
+	t, ok := c.p.(Transactional)
+	if !ok {
+		return nil, fmt.Errorf("config: provider %T does not support transactions", c.p)
+	}
+	return t, nil
+}
+
+// Txn 执行事务,设置了约束时先校验所有设置操作
+func (c *Client) Txn(ctx context.Context, cmps []Compare, ops ...Op) error {
+	t, err := c.transactional()
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if op.Type != OpPut {
+			continue
+		}
+		if err = c.check(op.Key, op.Value); err != nil {
+			return err
+		}
+	}
+	return t.Txn(ctx, cmps, ops...)
+}
+
+// GetRevision 获取配置及其最后修改的版本,不存在时版本为0
+func (c *Client) GetRevision(key string) (string, int64, error) {
+	t, err := c.transactional()
+	if err != nil {
+		return "", 0, err
+	}
+	v, rev, err := t.GetRevision(key)
+	if err != nil {
+		return "", 0, err
+	}
+	v, err = c.reveal(key, v)
+	return v, rev, err
+}
+
+// PutIfAbsent key不存在时设置,已存在时返回*ConflictError
+func (c *Client) PutIfAbsent(key, value string) error {
+	return c.Txn(context.Background(), []Compare{Absent(key)}, PutOp(key, value))
+}
+
+// CompareAndSwap key的值等于old时设置为new,否则返回*ConflictError
+//
+// 当前值为PutSecret写入的加密值时,比较解密后的明文,new同样加密后写入
+func (c *Client) CompareAndSwap(key, old, new string) error {
+	t, err := c.transactional()
+	if err != nil {
+		return err
+	}
+	raw, rev, err := t.GetRevision(key)
+	if err != nil {
+		return err
+	}
+	if !IsSecret(raw) {
+		return c.Txn(context.Background(), []Compare{ValueEquals(key, old)}, PutOp(key, new))
+	}
+
+	plain, err := c.reveal(key, raw)
+	if err != nil {
+		return err
+	}
+	// 不在错误中暴露明文
+	if plain != old {
+		return &ConflictError{Key: key, Expected: "<secret>", Actual: "<different secret>"}
+	}
+	if err = c.check(key, new); err != nil {
+		return err
+	}
+	sealed, err := c.keyring.Seal(key, new)
+	if err != nil {
+		return err
+	}
+	// 以版本保证读取后未被修改
+	return t.Txn(context.Background(), []Compare{ModRevisionEquals(key, rev)}, PutOp(key, sealed))
+}
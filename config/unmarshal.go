@@ -0,0 +1,338 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = validator.New()
+
+// maxSliceIndex 切片下标key的上限
+const maxSliceIndex = 10000
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Unmarshal 把前缀下的配置绑定到结构体,out必须是结构体指针
+//
+// 字段通过 config:"server_host" 指定key,未指定时使用字段名的蛇形命名;
+// 嵌套结构体对应子前缀,如 db/host;切片可以是逗号分隔的值,也可以是 hosts/0、hosts/1 这样的下标key;
+// key不存在或值为空时使用 default:"..." 的默认值;绑定完成后按 validate:"..." 规则校验
+//
+// example:
+//
+//	type ServerConfig struct {
+//	  Host    string        `config:"server_host" default:":8080" validate:"required"`
+//	  Timeout time.Duration `config:"timeout" default:"5s"`
+//	}
+//	var cfg ServerConfig
+//	err := cli.Unmarshal("admin", &cfg)
+func (c *Client) Unmarshal(prefix string, out any) error {
+	kvs, err := c.GetPrefix(prefixOf(prefix))
+	if err != nil {
+		return err
+	}
+	return Bind(trimPrefix(kvs, prefix), out)
+}
+
+// Bind 把相对key的配置绑定到结构体并校验,规则同Client.Unmarshal
+func Bind(kvs map[string]string, out any) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: bind target must be a non-nil struct pointer, got %T", out)
+	}
+	if err := bindStruct(kvs, "", rv.Elem()); err != nil {
+		return err
+	}
+	return validate.Struct(out)
+}
+
+// prefixOf 查询用的前缀,非空时以斜杠结尾,避免 admin 匹配到 admin2
+func prefixOf(prefix string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix
+	}
+	return prefix + "/"
+}
+
+// trimPrefix 去掉key的前缀,只保留前缀下的配置
+//
+// YAML、环境变量等后端返回的key统一为斜杠分隔,因此同时匹配规范化后的前缀,如 admin.db 与 admin/db
+func trimPrefix(kvs map[string]string, prefix string) map[string]string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	normalized := normalizeKey(prefix)
+	m := make(map[string]string, len(kvs))
+	for k, v := range kvs {
+		if prefix == "" {
+			m[strings.TrimPrefix(k, "/")] = v
+			continue
+		}
+		switch {
+		case strings.HasPrefix(k, prefix+"/"):
+			m[k[len(prefix)+1:]] = v
+		case normalized != "" && strings.HasPrefix(k, normalized+"/"):
+			m[k[len(normalized)+1:]] = v
+		}
+	}
+	return m
+}
+
+// bindStruct 绑定结构体字段,base为该结构体对应的key前缀
+func bindStruct(kvs map[string]string, base string, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, ok := f.Tag.Lookup("config")
+		if name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		// 未指定key的嵌入结构体,字段平铺到当前前缀
+		if f.Anonymous && !ok && fv.Kind() == reflect.Struct {
+			if err := bindStruct(kvs, base, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+		if err := bindValue(kvs, joinKey(base, name), f.Tag.Get("default"), fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindValue 绑定单个值
+func bindValue(kvs map[string]string, key, def string, v reflect.Value) error {
+	raw, ok := kvs[key]
+	if !ok || raw == "" {
+		raw, ok = def, def != ""
+	}
+
+	if isScalar(v.Type()) {
+		if !ok {
+			return nil
+		}
+		if err := setScalar(v, raw); err != nil {
+			return fmt.Errorf("config: %s: %w", key, err)
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !ok && !hasChildren(kvs, key) {
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return bindValue(kvs, key, def, v.Elem())
+	case reflect.Struct:
+		return bindStruct(kvs, key, v)
+	case reflect.Slice:
+		return bindSlice(kvs, key, raw, ok, v)
+	case reflect.Map:
+		return bindMap(kvs, key, v)
+	}
+	return fmt.Errorf("config: %s: unsupported type %s", key, v.Type())
+}
+
+// bindSlice 绑定切片,优先使用逗号分隔的值,否则读取下标key
+func bindSlice(kvs map[string]string, key, raw string, ok bool, v reflect.Value) error {
+	et := v.Type().Elem()
+	if ok && isScalar(et) {
+		parts := strings.Split(raw, ",")
+		s := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setScalar(s.Index(i), strings.TrimSpace(p)); err != nil {
+				return fmt.Errorf("config: %s/%d: %w", key, i, err)
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+
+	idx := childIndexes(kvs, key)
+	if len(idx) == 0 {
+		return nil
+	}
+	// 下标决定切片长度,避免误写的大下标导致分配超大切片
+	if last := idx[len(idx)-1]; last >= maxSliceIndex {
+		return fmt.Errorf("config: %s/%d: slice index out of range [0, %d)", key, last, maxSliceIndex)
+	}
+	s := reflect.MakeSlice(v.Type(), idx[len(idx)-1]+1, idx[len(idx)-1]+1)
+	for _, i := range idx {
+		if err := bindValue(kvs, joinKey(key, strconv.Itoa(i)), "", s.Index(i)); err != nil {
+			return err
+		}
+	}
+	v.Set(s)
+	return nil
+}
+
+// bindMap 绑定key为字符串的map,子key的第一段作为map的key
+func bindMap(kvs map[string]string, key string, v reflect.Value) error {
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("config: %s: unsupported map key type %s", key, v.Type().Key())
+	}
+	names := childNames(kvs, key)
+	if len(names) == 0 {
+		return nil
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(names)))
+	}
+	for _, name := range names {
+		ev := reflect.New(v.Type().Elem()).Elem()
+		if err := bindValue(kvs, joinKey(key, name), "", ev); err != nil {
+			return err
+		}
+		v.SetMapIndex(reflect.ValueOf(name).Convert(v.Type().Key()), ev)
+	}
+	return nil
+}
+
+// isScalar 是否可以直接由字符串解析
+func isScalar(t reflect.Type) bool {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setScalar 把字符串解析为字段类型
+func setScalar(v reflect.Value, raw string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// childNames key下一层子key的名称
+func childNames(kvs map[string]string, key string) []string {
+	prefix := key + "/"
+	seen := make(map[string]struct{})
+	var names []string
+	for k := range kvs {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		name := k[len(prefix):]
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[:i]
+		}
+		if _, ok := seen[name]; ok || name == "" {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// childIndexes key下一层数字子key,升序
+func childIndexes(kvs map[string]string, key string) []int {
+	var idx []int
+	for _, name := range childNames(kvs, key) {
+		if i, err := strconv.Atoi(name); err == nil && i >= 0 {
+			idx = append(idx, i)
+		}
+	}
+	sort.Ints(idx)
+	return idx
+}
+
+func hasChildren(kvs map[string]string, key string) bool {
+	prefix := key + "/"
+	for k := range kvs {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinKey(base, name string) string {
+	if base == "" {
+		return name
+	}
+	return base + "/" + name
+}
+
+// snakeCase ServerHost -> server_host
+func snakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
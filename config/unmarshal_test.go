@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testDB struct {
+	Host string `config:"host" validate:"required"`
+	Port int    `config:"port" default:"3306"`
+}
+
+type testServer struct {
+	Host    string            `config:"server_host" validate:"required"`
+	Debug   bool              `config:"debug"`
+	Timeout time.Duration     `config:"timeout" default:"5s"`
+	Origins []string          `config:"origins"`
+	DB      testDB            `config:"db"`
+	Replica []testDB          `config:"replica"`
+	Labels  map[string]string `config:"labels"`
+}
+
+func TestClient_Unmarshal(t *testing.T) {
+	cli, err := New(WithProvider(NewMemory(map[string]string{
+		"admin/server_host":    ":8081",
+		"admin/debug":          "true",
+		"admin/origins":        "a.com, b.com",
+		"admin/db/host":        "127.0.0.1",
+		"admin/replica/0/host": "10.0.0.1",
+		"admin/replica/1/host": "10.0.0.2",
+		"admin/labels/zone":    "cn",
+		"admin2/server_host":   ":9090",
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg testServer
+	if err = cli.Unmarshal("admin", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != ":8081" || !cfg.Debug || cfg.Timeout != 5*time.Second {
+		t.Fatalf("unmarshal scalar fields = %+v", cfg)
+	}
+	if len(cfg.Origins) != 2 || cfg.Origins[1] != "b.com" {
+		t.Fatalf("unmarshal origins = %v", cfg.Origins)
+	}
+	if cfg.DB.Host != "127.0.0.1" || cfg.DB.Port != 3306 {
+		t.Fatalf("unmarshal db = %+v", cfg.DB)
+	}
+	if len(cfg.Replica) != 2 || cfg.Replica[1].Host != "10.0.0.2" || cfg.Replica[1].Port != 3306 {
+		t.Fatalf("unmarshal replica = %+v", cfg.Replica)
+	}
+	if cfg.Labels["zone"] != "cn" {
+		t.Fatalf("unmarshal labels = %v", cfg.Labels)
+	}
+
+	var missing testServer
+	if err = cli.Unmarshal("admin3", &missing); err == nil {
+		t.Fatal("unmarshal admin3 should fail validation")
+	}
+}
+
+func TestClient_UnmarshalYamlPrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	err := os.WriteFile(path, []byte("admin:\n  db:\n    host: 127.0.0.1\n    port: 3307\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli, err := New(WithType(YAML), WithPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	var db testDB
+	if err = cli.Unmarshal("admin.db", &db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Host != "127.0.0.1" || db.Port != 3307 {
+		t.Fatalf("unmarshal admin.db = %+v", db)
+	}
+}
+
+func TestBind_SliceIndexLimit(t *testing.T) {
+	var cfg struct {
+		Replica []testDB `config:"replica"`
+	}
+	err := Bind(map[string]string{"replica/999999999/host": "10.0.0.1"}, &cfg)
+	if err == nil {
+		t.Fatal("bind with huge slice index should fail")
+	}
+}
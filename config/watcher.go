@@ -0,0 +1,102 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Watcher 前缀配置的热更新快照
+//
+// 每次监听到前缀下的变化都会重新读取整个前缀并绑定为新的*T,
+// 校验失败时保留旧快照;快照只读,不要修改Load返回的值
+//
+// example:
+//
+//	w, err := config.NewWatcher[ServerConfig](cli, "admin")
+//	w.OnChange(func(old, new *ServerConfig) {
+//	  log.Printf("server_host %s -> %s", old.Host, new.Host)
+//	})
+//	go w.Watch(ctx)
+//	cfg := w.Load()
+type Watcher[T any] struct {
+	cli    *Client
+	prefix string
+	cur    atomic.Pointer[T]
+
+	reload  sync.Mutex // 串行化重新绑定与通知
+	mu      sync.Mutex // 保护回调
+	hooks   []func(old, new *T)
+	onError func(err error)
+}
+
+// NewWatcher 创建快照并完成首次绑定,首次绑定失败时返回错误
+func NewWatcher[T any](cli *Client, prefix string) (*Watcher[T], error) {
+	w := &Watcher[T]{
+		cli:    cli,
+		prefix: prefix,
+	}
+	v := new(T)
+	if err := cli.Unmarshal(prefix, v); err != nil {
+		return nil, err
+	}
+	w.cur.Store(v)
+	return w, nil
+}
+
+// Load 当前快照
+func (w *Watcher[T]) Load() *T {
+	return w.cur.Load()
+}
+
+// OnChange 注册变更回调,快照替换后按注册顺序调用,回调中可以注册其他回调,但不能调用Reload
+func (w *Watcher[T]) OnChange(fn func(old, new *T)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.hooks = append(w.hooks, fn)
+}
+
+// OnError 设置重新绑定失败的回调,如新配置未通过校验
+func (w *Watcher[T]) OnError(fn func(err error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onError = fn
+}
+
+// Reload 重新读取前缀并替换快照,失败时保留旧快照并返回错误
+func (w *Watcher[T]) Reload() error {
+	w.reload.Lock()
+	defer w.reload.Unlock()
+
+	// 回调在锁外调用,回调中可以调用OnChange、OnError
+	w.mu.Lock()
+	hooks := make([]func(old, new *T), len(w.hooks))
+	copy(hooks, w.hooks)
+	onError := w.onError
+	w.mu.Unlock()
+
+	v := new(T)
+	if err := w.cli.Unmarshal(w.prefix, v); err != nil {
+		if onError != nil {
+			onError(err)
+		}
+		return err
+	}
+	old := w.cur.Load()
+	if reflect.DeepEqual(old, v) {
+		return nil
+	}
+	w.cur.Store(v)
+	for _, fn := range hooks {
+		fn(old, v)
+	}
+	return nil
+}
+
+// Watch 监听前缀变化并重新绑定,阻塞直到ctx取消或配置后端关闭
+func (w *Watcher[T]) Watch(ctx context.Context) error {
+	return w.cli.WatchPrefixContext(ctx, prefixOf(w.prefix), func(map[string]string) {
+		_ = w.Reload()
+	})
+}
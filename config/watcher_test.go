@@ -0,0 +1,130 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	cli, err := New(WithProvider(NewMemory(map[string]string{
+		"admin/db/host": "127.0.0.1",
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher[testDB](cli, "admin/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := w.Load(); cfg.Host != "127.0.0.1" || cfg.Port != 3306 {
+		t.Fatalf("initial snapshot = %+v", cfg)
+	}
+
+	type change struct{ old, new *testDB }
+	changes := make(chan change, 4)
+	errs := make(chan error, 4)
+	w.OnChange(func(old, new *testDB) {
+		changes <- change{old, new}
+	})
+	w.OnError(func(err error) {
+		errs <- err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Watch(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// 重新绑定
+	if err = cli.Put("admin/db/port", "3307"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-changes:
+		if c.old.Port != 3306 || c.new.Port != 3307 || c.new.Host != "127.0.0.1" {
+			t.Fatalf("change = %+v -> %+v", c.old, c.new)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch rebind timeout")
+	}
+	if w.Load().Port != 3307 {
+		t.Fatalf("snapshot after rebind = %+v", w.Load())
+	}
+
+	// 校验失败时保留旧快照
+	if err = cli.Delete("admin/db/host"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("invalid snapshot should report error")
+	}
+	if cfg := w.Load(); cfg.Host != "127.0.0.1" || cfg.Port != 3307 {
+		t.Fatalf("snapshot after invalid change = %+v", cfg)
+	}
+	select {
+	case c := <-changes:
+		t.Fatalf("invalid snapshot should not notify, got %+v", c.new)
+	default:
+	}
+
+	cancel()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch should stop when ctx is cancelled")
+	}
+}
+
+func TestWatcher_HookRegistersHook(t *testing.T) {
+	cli, err := New(WithProvider(NewMemory(map[string]string{
+		"admin/db/host": "127.0.0.1",
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher[testDB](cli, "admin/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int
+	w.OnChange(func(old, new *testDB) {
+		// 回调中注册回调不能死锁
+		w.OnChange(func(old, new *testDB) { calls++ })
+		w.OnError(func(err error) {})
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		if err := cli.Put("admin/db/port", "3307"); err != nil {
+			done <- err
+			return
+		}
+		done <- w.Reload()
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reload deadlocked")
+	}
+
+	if err = cli.Put("admin/db/port", "3308"); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("hook registered in hook called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,551 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// Yaml 基于YAML文件的配置
+//
+// key支持点号或斜杠分隔,如 admin.server_host 与 admin/server_host 等价,
+// 列表元素以下标作为key的一段,如 admin/hosts/0
+type Yaml struct {
+	path string
+
+	mu   sync.RWMutex
+	tree map[string]any    // 原始YAML树
+	kvs  map[string]string // 展开后的key/value
+	rev  int64             // 当前版本,每次加载到变化加一
+	revs map[string]int64  // 每个key最后修改的版本
+
+	done chan struct{}
+	once sync.Once
+}
+
+// newYamlClient 创建YAML客户端,文件不存在时视为空配置
+func newYamlClient(path string) (*Yaml, error) {
+	if path == "" {
+		return nil, fmt.Errorf("config: yaml path is empty")
+	}
+	y := &Yaml{
+		path: path,
+		done: make(chan struct{}),
+	}
+	if err := y.load(); err != nil {
+		return nil, err
+	}
+	return y, nil
+}
+
+// load 从文件加载配置
+func (y *Yaml) load() error {
+	tree, err := readYamlFile(y.path)
+	if err != nil {
+		return err
+	}
+	y.mu.Lock()
+	y.setTree(tree)
+	y.mu.Unlock()
+	return nil
+}
+
+// setTree 替换配置树并更新发生变化的key的版本,调用方需持有写锁
+func (y *Yaml) setTree(tree map[string]any) {
+	kvs := Flatten(tree)
+	changed := diffKvs(y.kvs, kvs)
+	if y.revs == nil {
+		y.revs = make(map[string]int64, len(kvs))
+	}
+	if len(changed) > 0 {
+		y.rev++
+	}
+	for k := range changed {
+		if _, ok := kvs[k]; ok {
+			y.revs[k] = y.rev
+		} else {
+			delete(y.revs, k)
+		}
+	}
+	y.tree = tree
+	y.kvs = kvs
+}
+
+// Get 获取配置
+func (y *Yaml) Get(key string) (string, error) {
+	y.mu.RLock()
+	defer y.mu.RUnlock()
+	// 由调用层判断是否存在
+	return y.kvs[normalizeKey(key)], nil
+}
+
+// GetPrefix 获取前缀配置
+func (y *Yaml) GetPrefix(prefix string) (map[string]string, error) {
+	prefix = normalizeKey(prefix)
+	y.mu.RLock()
+	defer y.mu.RUnlock()
+	var m map[string]string
+	for k, v := range y.kvs {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]string)
+		}
+		m[k] = v
+	}
+	// 由调用层判断是否存在
+	return m, nil
+}
+
+// Watch 监听配置
+func (y *Yaml) Watch(key string, callback func(key string, value string)) error {
+	key = normalizeKey(key)
+	return y.watch(func(changed map[string]string) {
+		if v, ok := changed[key]; ok {
+			callback(key, v)
+		}
+	})
+}
+
+// WatchPrefix 监听前缀配置
+func (y *Yaml) WatchPrefix(prefix string, callback func(map[string]string)) error {
+	prefix = normalizeKey(prefix)
+	return y.watch(func(changed map[string]string) {
+		m := make(map[string]string)
+		for k, v := range changed {
+			if strings.HasPrefix(k, prefix) {
+				m[k] = v
+			}
+		}
+		if len(m) > 0 {
+			callback(m)
+		}
+	})
+}
+
+// watch 监听文件变化,重新加载后把发生变化的key交给fn,删除的key值为空
+//
+// 监听的是文件所在目录,以兼容编辑器先写临时文件再重命名的保存方式
+func (y *Yaml) watch(fn func(changed map[string]string)) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err = w.Add(filepath.Dir(y.path)); err != nil {
+		return err
+	}
+	name := filepath.Clean(y.path)
+	// 每个监听各自保存上次看到的配置,本实例Put写入的变化也能被通知到
+	y.mu.RLock()
+	last := y.kvs
+	y.mu.RUnlock()
+
+	for {
+		select {
+		case <-y.done:
+			return nil
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(ev.Name) != name {
+				continue
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			// 文件写入过程中可能解析失败,等待下一次事件
+			if err := y.load(); err != nil {
+				continue
+			}
+			y.mu.RLock()
+			cur := y.kvs
+			y.mu.RUnlock()
+			changed := diffKvs(last, cur)
+			last = cur
+			if len(changed) > 0 {
+				fn(changed)
+			}
+		}
+	}
+}
+
+// Put 设置配置并写回文件
+func (y *Yaml) Put(key, value string) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	tree := cloneTree(y.tree)
+	if err := setPath(tree, splitKey(key), value); err != nil {
+		return err
+	}
+	return y.save(tree)
+}
+
+// PutMany 设置多个配置并一次写回文件
+func (y *Yaml) PutMany(kvs map[string]string) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	tree := cloneTree(y.tree)
+	for k, v := range kvs {
+		if err := setPath(tree, splitKey(k), v); err != nil {
+			return err
+		}
+	}
+	return y.save(tree)
+}
+
+// GetRevision 获取配置及其最后修改的版本,不存在时版本为0
+//
+// 版本只在当前进程内有效,从打开文件时开始计数
+func (y *Yaml) GetRevision(key string) (string, int64, error) {
+	key = normalizeKey(key)
+	y.mu.RLock()
+	defer y.mu.RUnlock()
+	return y.kvs[key], y.revs[key], nil
+}
+
+// Txn 所有条件满足时执行全部操作并一次写回文件,否则不执行任何操作并返回*ConflictError
+func (y *Yaml) Txn(_ context.Context, cmps []Compare, ops ...Op) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	for _, c := range cmps {
+		key := normalizeKey(c.Key)
+		v, exists := y.kvs[key]
+		if !c.match(v, y.revs[key], exists) {
+			return c.conflict(v, y.revs[key], exists)
+		}
+	}
+	tree := cloneTree(y.tree)
+	for _, op := range ops {
+		switch op.Type {
+		case OpPut:
+			if err := setPath(tree, splitKey(op.Key), op.Value); err != nil {
+				return err
+			}
+		case OpDelete:
+			deletePath(tree, splitKey(op.Key))
+		}
+	}
+	return y.save(tree)
+}
+
+// PutIfAbsent key不存在时设置,已存在时返回*ConflictError
+func (y *Yaml) PutIfAbsent(key, value string) error {
+	return y.Txn(context.Background(), []Compare{Absent(key)}, PutOp(key, value))
+}
+
+// CompareAndSwap key的值等于old时设置为new,否则返回*ConflictError
+func (y *Yaml) CompareAndSwap(key, old, new string) error {
+	return y.Txn(context.Background(), []Compare{ValueEquals(key, old)}, PutOp(key, new))
+}
+
+// Delete 删除配置并写回文件
+func (y *Yaml) Delete(key string) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	tree := cloneTree(y.tree)
+	deletePath(tree, splitKey(key))
+	return y.save(tree)
+}
+
+// save 写回文件,调用方需持有写锁
+func (y *Yaml) save(tree map[string]any) error {
+	if err := writeYamlFile(y.path, tree); err != nil {
+		return err
+	}
+	y.setTree(tree)
+	return nil
+}
+
+// Close 关闭YAML客户端,结束所有监听
+func (y *Yaml) Close() error {
+	y.once.Do(func() {
+		close(y.done)
+	})
+	return nil
+}
+
+// readYamlFile 读取YAML文件
+func readYamlFile(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]any{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]any)
+	if err = yaml.Unmarshal(b, &tree); err != nil {
+		return nil, fmt.Errorf("config: parse %s: %w", path, err)
+	}
+	return tree, nil
+}
+
+// writeYamlFile 先写临时文件再重命名,避免监听方读到写了一半的文件
+func writeYamlFile(path string, tree map[string]any) error {
+	b, err := yaml.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// normalizeKey 统一key格式为斜杠分隔
+func normalizeKey(key string) string {
+	return strings.Join(splitKey(key), "/")
+}
+
+// splitKey 按点号或斜杠拆分key
+func splitKey(key string) []string {
+	return strings.FieldsFunc(key, func(r rune) bool {
+		return r == '.' || r == '/'
+	})
+}
+
+// Flatten 把嵌套的配置树展开为斜杠分隔的key/value,列表元素以下标作为key
+func Flatten(tree map[string]any) map[string]string {
+	m := make(map[string]string)
+	flattenInto(m, "", tree)
+	return m
+}
+
+func flattenInto(m map[string]string, prefix string, node any) {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "/" + k
+	}
+	switch n := node.(type) {
+	case map[string]any:
+		for k, v := range n {
+			flattenInto(m, join(k), v)
+		}
+	case map[any]any:
+		for k, v := range n {
+			flattenInto(m, join(fmt.Sprint(k)), v)
+		}
+	case []any:
+		for i, v := range n {
+			flattenInto(m, join(strconv.Itoa(i)), v)
+		}
+	case nil:
+		if prefix != "" {
+			m[prefix] = ""
+		}
+	case string:
+		m[prefix] = n
+	default:
+		m[prefix] = fmt.Sprint(n)
+	}
+}
+
+// Expand 把斜杠分隔的key/value还原为嵌套的配置树,是Flatten的逆操作
+func Expand(kvs map[string]string) map[string]any {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	// 排序保证列表下标按顺序写入
+	sort.Slice(keys, func(i, j int) bool {
+		return lessKey(keys[i], keys[j])
+	})
+	tree := make(map[string]any)
+	for _, k := range keys {
+		_ = setPath(tree, splitKey(k), kvs[k])
+	}
+	return tree
+}
+
+// lessKey 按段比较key,数字段按数值比较
+func lessKey(a, b string) bool {
+	as, bs := splitKey(a), splitKey(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		ai, aErr := strconv.Atoi(as[i])
+		bi, bErr := strconv.Atoi(bs[i])
+		if aErr == nil && bErr == nil {
+			return ai < bi
+		}
+		return as[i] < bs[i]
+	}
+	return len(as) < len(bs)
+}
+
+// setPath 在配置树中设置值,中间节点不存在时自动创建
+func setPath(tree map[string]any, path []string, value string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("config: empty key")
+	}
+	var node any = tree
+	var parentSet func(any)
+	for i, seg := range path {
+		last := i == len(path)-1
+		switch n := node.(type) {
+		case map[string]any:
+			if last {
+				n[seg] = value
+				return nil
+			}
+			child, ok := n[seg]
+			if !ok || !isContainer(child) {
+				child = map[string]any{}
+				n[seg] = child
+			}
+			key := seg
+			parentSet = func(v any) { n[key] = v }
+			node = child
+		case []any:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx > len(n) {
+				return fmt.Errorf("config: invalid list index %q in %s", seg, strings.Join(path, "/"))
+			}
+			if idx == len(n) {
+				n = append(n, nil)
+				parentSet(n)
+			}
+			if last {
+				n[idx] = value
+				return nil
+			}
+			if !isContainer(n[idx]) {
+				n[idx] = map[string]any{}
+			}
+			list := n
+			parentSet = func(v any) { list[idx] = v }
+			node = n[idx]
+		}
+		// 数字段的子节点按列表创建
+		if !last {
+			if m, ok := node.(map[string]any); ok && len(m) == 0 {
+				if _, err := strconv.Atoi(path[i+1]); err == nil {
+					node = []any{}
+					parentSet(node)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// deletePath 从配置树中删除值
+func deletePath(tree map[string]any, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	deleteNode(tree, path)
+}
+
+// deleteNode 删除node下的path,返回删除后的node;列表元素会被移除而不是置空,后续元素的下标前移
+func deleteNode(node any, path []string) any {
+	seg, last := path[0], len(path) == 1
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[seg]
+		if !ok {
+			return n
+		}
+		if last {
+			delete(n, seg)
+		} else {
+			n[seg] = deleteNode(child, path[1:])
+		}
+		return n
+	case []any:
+		idx, err := strconv.Atoi(seg)
+		if err != nil || idx < 0 || idx >= len(n) {
+			return n
+		}
+		if last {
+			l := make([]any, 0, len(n)-1)
+			l = append(l, n[:idx]...)
+			return append(l, n[idx+1:]...)
+		}
+		n[idx] = deleteNode(n[idx], path[1:])
+		return n
+	}
+	return node
+}
+
+func isContainer(v any) bool {
+	switch v.(type) {
+	case map[string]any, []any:
+		return true
+	}
+	return false
+}
+
+// cloneTree 深拷贝配置树,写文件失败时不影响内存中的配置
+func cloneTree(tree map[string]any) map[string]any {
+	return cloneNode(tree).(map[string]any)
+}
+
+func cloneNode(node any) any {
+	switch n := node.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(n))
+		for k, v := range n {
+			m[k] = cloneNode(v)
+		}
+		return m
+	case map[any]any:
+		m := make(map[string]any, len(n))
+		for k, v := range n {
+			m[fmt.Sprint(k)] = cloneNode(v)
+		}
+		return m
+	case []any:
+		l := make([]any, len(n))
+		for i, v := range n {
+			l[i] = cloneNode(v)
+		}
+		return l
+	}
+	return node
+}
+
+// diffKvs 对比新旧配置,返回新增或修改的key及其新值,删除的key值为空
+func diffKvs(old, cur map[string]string) map[string]string {
+	changed := make(map[string]string)
+	for k, v := range cur {
+		if ov, ok := old[k]; !ok || ov != v {
+			changed[k] = v
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			changed[k] = ""
+		}
+	}
+	return changed
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestYaml(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	err := os.WriteFile(path, []byte("admin:\n  server_host: \":8081\"\n  hosts:\n    - a\n    - b\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli, err := New(WithType(YAML), WithPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	v, err := cli.Yaml.Get("admin.server_host")
+	if err != nil || v != ":8081" {
+		t.Fatalf("get admin.server_host = %q, %v", v, err)
+	}
+	m, err := cli.Yaml.GetPrefix("admin/hosts")
+	if err != nil || len(m) != 2 || m["admin/hosts/1"] != "b" {
+		t.Fatalf("get prefix admin/hosts = %v, %v", m, err)
+	}
+
+	changed := make(chan string, 1)
+	go cli.Yaml.Watch("admin/log_path", func(key, value string) {
+		changed <- value
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	if err = cli.Yaml.Put("admin/log_path", "app.log"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v = <-changed:
+		if v != "app.log" {
+			t.Fatalf("watch admin/log_path = %q", v)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("watch admin/log_path timeout")
+	}
+
+	if err = cli.Yaml.Delete("admin/hosts/0"); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := newYamlClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ = reloaded.Get("admin/log_path"); v != "app.log" {
+		t.Fatalf("reload admin/log_path = %q", v)
+	}
+	// 删除的列表元素被移除,不留下空值
+	if m, _ = reloaded.GetPrefix("admin/hosts"); len(m) != 1 || m["admin/hosts/0"] != "b" {
+		t.Fatalf("reload admin/hosts = %v", m)
+	}
+}
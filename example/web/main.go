@@ -23,7 +23,9 @@ func main() {
 	if err != nil {
 		logger.Fatal(err)
 	}
-	srv.Run()
+	if err = srv.Run(); err != nil {
+		logger.Fatal(err)
+	}
 }
 
 type Greeter struct {
@@ -0,0 +1,334 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/cloudneedle/gokit/redis"
+	"github.com/cloudneedle/gokit/tools"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Job 任务
+type Job[T any] struct {
+	ID         string    // 任务ID
+	Payload    T         // 任务数据
+	Attempt    int       // 第几次执行,从1开始
+	EnqueuedAt time.Time // 入队时间
+	Error      string    // 最后一次失败的原因,只在死信中有值
+}
+
+// envelope 任务在Redis中的存储格式
+type envelope struct {
+	ID         string `json:"id"`
+	Payload    []byte `json:"payload"`
+	Attempt    int    `json:"attempt"`
+	EnqueuedAt int64  `json:"enqueued_at"` // 毫秒时间戳
+}
+
+type options struct {
+	codec      redis.Codec
+	group      string
+	maxRetries int
+	backoffMin time.Duration
+	backoffMax time.Duration
+	visibility time.Duration
+	maxLen     int64
+}
+
+// Option 队列选项
+type Option func(*options)
+
+// WithCodec 设置任务数据的编解码,默认JSON
+func WithCodec(codec redis.Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithGroup 设置消费组名称,默认 workers
+func WithGroup(group string) Option {
+	return func(o *options) {
+		o.group = group
+	}
+}
+
+// WithMaxRetries 设置失败后的最大重试次数,超过后进入死信,默认5
+func WithMaxRetries(n int) Option {
+	return func(o *options) {
+		o.maxRetries = n
+	}
+}
+
+// WithBackoff 设置重试间隔,从min开始每次翻倍直到max,默认1秒到10分钟
+func WithBackoff(min, max time.Duration) Option {
+	return func(o *options) {
+		o.backoffMin, o.backoffMax = min, max
+	}
+}
+
+// WithVisibilityTimeout 设置任务的可见性超时,已投递但超过该时间未确认的任务会被其他消费者认领,默认30秒
+//
+// 应大于任务的最长执行时间
+func WithVisibilityTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.visibility = d
+	}
+}
+
+// WithMaxLen 设置stream的近似最大长度,0表示不限制
+func WithMaxLen(n int64) Option {
+	return func(o *options) {
+		o.maxLen = n
+	}
+}
+
+// Queue 基于Redis Streams消费组的任务队列
+//
+// 所有key使用同一个hash tag,集群模式下位于同一个slot:
+//
+//	queue:{name}          待执行的任务
+//	queue:{name}:delayed  延迟与等待重试的任务,按执行时间排序
+//	queue:{name}:dead     超过重试次数的任务
+//
+// example:
+//
+//	emails := queue.New[Email](cli, "emails")
+//	_, err := emails.Enqueue(ctx, Email{To: "a@b.com"})
+type Queue[T any] struct {
+	c       *redis.Client
+	name    string
+	stream  string
+	delayed string
+	dead    string
+	opts    options
+}
+
+// New 创建队列
+func New[T any](c *redis.Client, name string, opts ...Option) *Queue[T] {
+	o := options{
+		codec:      redis.JSONCodec{},
+		group:      "workers",
+		maxRetries: 5,
+		backoffMin: time.Second,
+		backoffMax: 10 * time.Minute,
+		visibility: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	stream := "queue:{" + name + "}"
+	return &Queue[T]{
+		c:       c,
+		name:    name,
+		stream:  stream,
+		delayed: stream + ":delayed",
+		dead:    stream + ":dead",
+		opts:    o,
+	}
+}
+
+// Name 队列名称
+func (q *Queue[T]) Name() string {
+	return q.name
+}
+
+type enqueueOptions struct {
+	runAt time.Time
+}
+
+// EnqueueOption 入队选项
+type EnqueueOption func(*enqueueOptions)
+
+// WithDelay 延迟d后执行
+func WithDelay(d time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.runAt = time.Now().Add(d)
+	}
+}
+
+// WithRunAt 在指定时间执行
+func WithRunAt(t time.Time) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.runAt = t
+	}
+}
+
+// Enqueue 入队,返回任务ID
+func (q *Queue[T]) Enqueue(ctx context.Context, payload T, opts ...EnqueueOption) (string, error) {
+	var o enqueueOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	b, err := q.opts.codec.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	env := envelope{
+		ID:         tools.GetUUID(),
+		Payload:    b,
+		Attempt:    1,
+		EnqueuedAt: time.Now().UnixMilli(),
+	}
+	if o.runAt.After(time.Now()) {
+		err = q.schedule(ctx, q.c, env, o.runAt)
+	} else {
+		err = q.add(ctx, q.c, q.stream, env)
+	}
+	if err != nil {
+		return "", err
+	}
+	return env.ID, nil
+}
+
+// add 写入stream
+func (q *Queue[T]) add(ctx context.Context, c goredis.Cmdable, stream string, env envelope, extra ...any) error {
+	b, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	args := &goredis.XAddArgs{
+		Stream: stream,
+		Values: append([]any{"job", b}, extra...),
+	}
+	if stream == q.stream && q.opts.maxLen > 0 {
+		args.MaxLen, args.Approx = q.opts.maxLen, true
+	}
+	return c.XAdd(ctx, args).Err()
+}
+
+// schedule 写入延迟队列
+func (q *Queue[T]) schedule(ctx context.Context, c goredis.Cmdable, env envelope, runAt time.Time) error {
+	b, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return c.ZAdd(ctx, q.delayed, goredis.Z{Score: float64(runAt.UnixMilli()), Member: b}).Err()
+}
+
+// promoteScript 将到期的延迟任务移入stream
+//
+// KEYS[1] 延迟队列 KEYS[2] stream ARGV[1] 当前时间(毫秒) ARGV[2] 单次最多移动的数量
+var promoteScript = goredis.NewScript(`
+local items = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, item in ipairs(items) do
+	redis.call("XADD", KEYS[2], "*", "job", item)
+	redis.call("ZREM", KEYS[1], item)
+end
+return #items
+`)
+
+// promote 将到期的延迟任务移入stream,返回移动的数量
+func (q *Queue[T]) promote(ctx context.Context) (int64, error) {
+	return promoteScript.Run(ctx, q.c, []string{q.delayed, q.stream}, time.Now().UnixMilli(), 100).Int64()
+}
+
+// backoff 第attempt次执行失败后的重试间隔,加入随机抖动
+func (q *Queue[T]) backoff(attempt int) time.Duration {
+	d := q.opts.backoffMin
+	for i := 1; i < attempt && d < q.opts.backoffMax; i++ {
+		d *= 2
+	}
+	if d > q.opts.backoffMax {
+		d = q.opts.backoffMax
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// decodeEnvelope 解码stream中的job字段
+func decodeEnvelope(raw any) (envelope, error) {
+	var env envelope
+	s, _ := raw.(string)
+	err := json.Unmarshal([]byte(s), &env)
+	return env, err
+}
+
+// decode 解码任务
+func (q *Queue[T]) decode(raw any) (*Job[T], envelope, error) {
+	env, err := decodeEnvelope(raw)
+	if err != nil {
+		return nil, env, err
+	}
+	job := &Job[T]{
+		ID:         env.ID,
+		Attempt:    env.Attempt,
+		EnqueuedAt: time.UnixMilli(env.EnqueuedAt),
+	}
+	if err := q.opts.codec.Unmarshal(env.Payload, &job.Payload); err != nil {
+		return nil, env, err
+	}
+	return job, env, nil
+}
+
+// Len 待执行、延迟与死信任务的数量
+func (q *Queue[T]) Len(ctx context.Context) (pending, delayed, dead int64, err error) {
+	pipe := q.c.Pipeline()
+	p := pipe.XLen(ctx, q.stream)
+	d := pipe.ZCard(ctx, q.delayed)
+	x := pipe.XLen(ctx, q.dead)
+	if _, err = pipe.Exec(ctx); err != nil {
+		return 0, 0, 0, err
+	}
+	return p.Val(), d.Val(), x.Val(), nil
+}
+
+// Dead 最近进入死信的任务,最多count个
+func (q *Queue[T]) Dead(ctx context.Context, count int64) ([]*Job[T], error) {
+	msgs, err := q.c.XRevRangeN(ctx, q.dead, "+", "-", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job[T], 0, len(msgs))
+	for _, m := range msgs {
+		job, _, err := q.decode(m.Values["job"])
+		if err != nil {
+			continue
+		}
+		job.Error, _ = m.Values["error"].(string)
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Retry 将死信任务重新入队并从死信中删除,返回重新入队的数量
+func (q *Queue[T]) Retry(ctx context.Context, ids ...string) (int, error) {
+	msgs, err := q.c.XRange(ctx, q.dead, "-", "+").Result()
+	if err != nil {
+		return 0, err
+	}
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	n := 0
+	for _, m := range msgs {
+		env, err := decodeEnvelope(m.Values["job"])
+		if err != nil || !want[env.ID] {
+			continue
+		}
+		env.Attempt = 1
+		_, err = q.c.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			if err := q.add(ctx, pipe, q.stream, env); err != nil {
+				return err
+			}
+			return pipe.XDel(ctx, q.dead, m.ID).Err()
+		})
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// consumerName 默认的消费者名称,主机名加随机后缀
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "consumer"
+	}
+	return host + "-" + tools.GetUUID()[:8]
+}
@@ -0,0 +1,27 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	q := New[string](nil, "test", WithBackoff(time.Second, 4*time.Second))
+	for attempt, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 4 * time.Second} {
+		d := q.backoff(attempt)
+		if d < max/2 || d > max {
+			t.Fatalf("backoff(%d) = %v, want [%v, %v]", attempt, d, max/2, max)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	q := New[map[string]int](nil, "test")
+	job, env, err := q.decode(`{"id":"1","payload":"eyJhIjoxfQ==","attempt":2,"enqueued_at":1000}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != "1" || job.Attempt != 2 || job.Payload["a"] != 1 || env.EnqueuedAt != 1000 {
+		t.Fatalf("job = %+v", job)
+	}
+}
@@ -0,0 +1,369 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Handler 任务处理函数,返回错误时按退避策略重试
+type Handler[T any] func(ctx context.Context, job *Job[T]) error
+
+type workerOptions struct {
+	concurrency int
+	consumer    string
+	poll        time.Duration
+}
+
+// WorkerOption 消费者选项
+type WorkerOption func(*workerOptions)
+
+// WithConcurrency 设置同时执行的任务数,默认10
+func WithConcurrency(n int) WorkerOption {
+	return func(o *workerOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithConsumer 设置消费者名称,默认为主机名加随机后缀
+func WithConsumer(name string) WorkerOption {
+	return func(o *workerOptions) {
+		o.consumer = name
+	}
+}
+
+// WithPollInterval 设置检查到期延迟任务的间隔,默认1秒
+func WithPollInterval(d time.Duration) WorkerOption {
+	return func(o *workerOptions) {
+		o.poll = d
+	}
+}
+
+// Worker 消费者,从消费组中读取任务并执行
+//
+// example:
+//
+//	w := emails.Worker(func(ctx context.Context, job *queue.Job[Email]) error {
+//	  return send(ctx, job.Payload)
+//	}, queue.WithConcurrency(5))
+//	if err := w.Start(ctx); err != nil {
+//	  return err
+//	}
+//	server.OnStop(w.Stop) // Server关闭时停止消费并等待执行中的任务
+type Worker[T any] struct {
+	q       *Queue[T]
+	handler Handler[T]
+	opts    workerOptions
+
+	mu        sync.Mutex
+	cancel    context.CancelFunc // 停止读取任务
+	jobCancel context.CancelFunc // 取消执行中的任务
+	wg        sync.WaitGroup
+	claimed   chan delivery
+}
+
+// delivery 投递的消息,count为该消息的投递次数,重新认领时大于1
+type delivery struct {
+	msg   goredis.XMessage
+	count int64
+}
+
+// Worker 创建消费者
+func (q *Queue[T]) Worker(handler Handler[T], opts ...WorkerOption) *Worker[T] {
+	o := workerOptions{
+		concurrency: 10,
+		consumer:    consumerName(),
+		poll:        time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.concurrency < 1 {
+		o.concurrency = 1
+	}
+	return &Worker[T]{
+		q:       q,
+		handler: handler,
+		opts:    o,
+		claimed: make(chan delivery),
+	}
+}
+
+// Start 创建消费组并开始消费,不阻塞
+func (w *Worker[T]) Start(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		return errors.New("queue: worker already started")
+	}
+	err := w.q.c.XGroupCreateMkStream(ctx, w.q.stream, w.q.opts.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	loopCtx, cancel := context.WithCancel(context.Background())
+	jobCtx, jobCancel := context.WithCancel(context.Background())
+	w.cancel, w.jobCancel = cancel, jobCancel
+	for i := 0; i < w.opts.concurrency; i++ {
+		w.wg.Add(1)
+		go w.work(loopCtx, jobCtx)
+	}
+	w.wg.Add(2)
+	go w.reclaim(loopCtx)
+	go w.promote(loopCtx)
+	return nil
+}
+
+// Stop 停止读取新任务并等待执行中的任务完成,ctx到期时取消执行中的任务
+//
+// 被取消的任务不会确认,可见性超时后由其他消费者重新执行
+func (w *Worker[T]) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	cancel, jobCancel := w.cancel, w.jobCancel
+	w.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		jobCancel()
+		return nil
+	case <-ctx.Done():
+		jobCancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// work 读取并执行任务,优先执行认领到的超时任务
+func (w *Worker[T]) work(ctx, jobCtx context.Context) {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-w.claimed:
+			w.process(jobCtx, d.msg, d.count)
+			continue
+		default:
+		}
+
+		streams, err := w.q.c.XReadGroup(ctx, &goredis.XReadGroupArgs{
+			Group:    w.q.opts.group,
+			Consumer: w.opts.consumer,
+			Streams:  []string{w.q.stream, ">"},
+			Count:    1,
+			Block:    time.Second,
+		}).Result()
+		if err == goredis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Println("Queue Read:", err)
+			sleep(ctx, time.Second)
+			continue
+		}
+		for _, s := range streams {
+			for _, m := range s.Messages {
+				w.process(jobCtx, m, 1)
+			}
+		}
+	}
+}
+
+// reclaim 认领超过可见性超时仍未确认的任务
+func (w *Worker[T]) reclaim(ctx context.Context) {
+	defer w.wg.Done()
+	interval := w.q.opts.visibility / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := "0-0"
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ds, next, err := w.claim(ctx, start)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("Queue Reclaim:", err)
+			}
+			continue
+		}
+		start = next
+		for _, d := range ds {
+			select {
+			case w.claimed <- d:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// claim 认领一批超时任务,并查询每个任务的投递次数
+//
+// 消费者崩溃或任务卡住时不会走失败重试的流程,按投递次数计入Attempt,避免任务被无限次认领
+func (w *Worker[T]) claim(ctx context.Context, start string) ([]delivery, string, error) {
+	msgs, next, err := w.q.c.XAutoClaim(ctx, &goredis.XAutoClaimArgs{
+		Stream:   w.q.stream,
+		Group:    w.q.opts.group,
+		MinIdle:  w.q.opts.visibility,
+		Start:    start,
+		Count:    int64(w.opts.concurrency),
+		Consumer: w.opts.consumer,
+	}).Result()
+	if err != nil || len(msgs) == 0 {
+		return nil, next, err
+	}
+
+	pipe := w.q.c.Pipeline()
+	cmds := make([]*goredis.XPendingExtCmd, len(msgs))
+	for i, m := range msgs {
+		cmds[i] = pipe.XPendingExt(ctx, &goredis.XPendingExtArgs{
+			Stream: w.q.stream,
+			Group:  w.q.opts.group,
+			Start:  m.ID,
+			End:    m.ID,
+			Count:  1,
+		})
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		return nil, next, err
+	}
+	ds := make([]delivery, len(msgs))
+	for i, m := range msgs {
+		ds[i] = delivery{msg: m, count: 1}
+		if p := cmds[i].Val(); len(p) == 1 && p[0].RetryCount > 1 {
+			ds[i].count = p[0].RetryCount
+		}
+	}
+	return ds, next, nil
+}
+
+// promote 定期将到期的延迟任务移入stream
+func (w *Worker[T]) promote(ctx context.Context) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.opts.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := w.q.promote(ctx); err != nil && ctx.Err() == nil {
+			log.Println("Queue Promote:", err)
+		}
+	}
+}
+
+// process 执行任务并确认,失败时重新调度或进入死信
+//
+// deliveries为消息的投递次数,未确认而被重新认领的投递也计入Attempt
+func (w *Worker[T]) process(ctx context.Context, m goredis.XMessage, deliveries int64) {
+	raw, ok := m.Values["job"]
+	if !ok {
+		// 消息已被删除
+		w.finish(m.ID, nil)
+		return
+	}
+	job, env, err := w.q.decode(raw)
+	if err != nil {
+		// 无法解码的任务直接进入死信
+		w.finish(m.ID, func(pipe goredis.Pipeliner) error {
+			return pipe.XAdd(context.Background(), &goredis.XAddArgs{
+				Stream: w.q.dead,
+				Values: []any{"job", raw, "error", err.Error()},
+			}).Err()
+		})
+		return
+	}
+	if deliveries > 1 {
+		env.Attempt += int(deliveries - 1)
+		job.Attempt = env.Attempt
+		if env.Attempt > w.q.opts.maxRetries+1 {
+			// 多次投递都未确认,不再执行
+			w.finish(m.ID, func(pipe goredis.Pipeliner) error {
+				msg := fmt.Sprintf("queue: not acknowledged after %d deliveries", deliveries)
+				return w.q.add(context.Background(), pipe, w.q.dead, env, "error", msg)
+			})
+			return
+		}
+	}
+
+	err = w.call(ctx, job)
+	if err != nil && ctx.Err() != nil {
+		// 停止时被取消,不确认,等待重新认领
+		return
+	}
+	if err == nil {
+		w.finish(m.ID, nil)
+		return
+	}
+	w.finish(m.ID, func(pipe goredis.Pipeliner) error {
+		if env.Attempt > w.q.opts.maxRetries {
+			return w.q.add(context.Background(), pipe, w.q.dead, env, "error", err.Error())
+		}
+		runAt := time.Now().Add(w.q.backoff(env.Attempt))
+		env.Attempt++
+		return w.q.schedule(context.Background(), pipe, env, runAt)
+	})
+}
+
+// call 调用处理函数,panic视为失败
+func (w *Worker[T]) call(ctx context.Context, job *Job[T]) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("queue: panic: %v", r)
+		}
+	}()
+	return w.handler(ctx, job)
+}
+
+// finish 在同一个事务中执行fn并确认、删除消息
+func (w *Worker[T]) finish(id string, fn func(pipe goredis.Pipeliner) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := w.q.c.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		if fn != nil {
+			if err := fn(pipe); err != nil {
+				return err
+			}
+		}
+		pipe.XAck(ctx, w.q.stream, w.q.opts.group, id)
+		pipe.XDel(ctx, w.q.stream, id)
+		return nil
+	})
+	if err != nil {
+		log.Println("Queue Ack:", err)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cloudneedle/gokit/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func newTestQueue(t *testing.T, opts ...Option) *Queue[string] {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	c := redis.NewClient(redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { c.Close() })
+	return New[string](c, "test", append([]Option{WithBackoff(time.Millisecond, time.Millisecond)}, opts...)...)
+}
+
+// startWorker 启动消费者,测试结束时停止
+func startWorker(t *testing.T, q *Queue[string], handler Handler[string]) {
+	t.Helper()
+	w := q.Worker(handler, WithConcurrency(2), WithPollInterval(10*time.Millisecond))
+	if err := w.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		w.Stop(ctx)
+	})
+}
+
+// waitLen 等待队列各部分的任务数量达到预期
+func waitLen(t *testing.T, q *Queue[string], pending, delayed, dead int64) {
+	t.Helper()
+	var p, d, x int64
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var err error
+		if p, d, x, err = q.Len(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if p == pending && d == delayed && x == dead {
+			return
+		}
+	}
+	t.Fatalf("len = %d, %d, %d, want %d, %d, %d", p, d, x, pending, delayed, dead)
+}
+
+func TestWorker_Ack(t *testing.T) {
+	q := newTestQueue(t)
+	done := make(chan *Job[string], 1)
+	startWorker(t, q, func(ctx context.Context, job *Job[string]) error {
+		done <- job
+		return nil
+	})
+
+	id, err := q.Enqueue(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case job := <-done:
+		if job.ID != id || job.Payload != "hello" || job.Attempt != 1 {
+			t.Fatalf("job = %+v", job)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("job not processed")
+	}
+	waitLen(t, q, 0, 0, 0)
+}
+
+func TestWorker_RetryAndDead(t *testing.T) {
+	q := newTestQueue(t, WithMaxRetries(2))
+	var mu sync.Mutex
+	var attempts []int
+	startWorker(t, q, func(ctx context.Context, job *Job[string]) error {
+		mu.Lock()
+		attempts = append(attempts, job.Attempt)
+		mu.Unlock()
+		return errors.New("fail")
+	})
+
+	if _, err := q.Enqueue(context.Background(), "fail"); err != nil {
+		t.Fatal(err)
+	}
+	waitLen(t, q, 0, 0, 1)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 3 || attempts[0] != 1 || attempts[2] != 3 {
+		t.Fatalf("attempts = %v", attempts)
+	}
+	jobs, err := q.Dead(context.Background(), 10)
+	if err != nil || len(jobs) != 1 || jobs[0].Error != "fail" || jobs[0].Attempt != 3 {
+		t.Fatalf("dead = %+v, %v", jobs, err)
+	}
+
+}
+
+func TestWorker_Delayed(t *testing.T) {
+	q := newTestQueue(t)
+	done := make(chan time.Time, 1)
+	startWorker(t, q, func(ctx context.Context, job *Job[string]) error {
+		done <- time.Now()
+		return nil
+	})
+
+	start := time.Now()
+	if _, err := q.Enqueue(context.Background(), "later", WithDelay(200*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, delayed, _, _ := q.Len(context.Background()); delayed != 1 {
+		t.Fatalf("delayed = %d", delayed)
+	}
+	select {
+	case at := <-done:
+		if at.Sub(start) < 200*time.Millisecond {
+			t.Fatalf("delayed job ran after %v", at.Sub(start))
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("delayed job not promoted")
+	}
+	waitLen(t, q, 0, 0, 0)
+}
+
+func TestWorker_Reclaim(t *testing.T) {
+	q := newTestQueue(t, WithVisibilityTimeout(20*time.Millisecond), WithMaxRetries(1))
+	ctx := context.Background()
+	if err := q.c.XGroupCreateMkStream(ctx, q.stream, q.opts.group, "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(ctx, "crash"); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟消费者读取后崩溃
+	if err := q.c.XReadGroup(ctx, &goredis.XReadGroupArgs{
+		Group:    q.opts.group,
+		Consumer: "crashed",
+		Streams:  []string{q.stream, ">"},
+		Count:    1,
+	}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := q.Worker(func(ctx context.Context, job *Job[string]) error { return nil })
+	claim := func() []delivery {
+		time.Sleep(30 * time.Millisecond)
+		ds, _, err := w.claim(ctx, "0-0")
+		if err != nil || len(ds) != 1 {
+			t.Fatalf("claim = %+v, %v", ds, err)
+		}
+		return ds
+	}
+
+	// 第二次投递,计入Attempt后仍在重试次数内
+	ds := claim()
+	if ds[0].count != 2 {
+		t.Fatalf("deliveries = %d, want 2", ds[0].count)
+	}
+	// 未确认,模拟任务卡住后再次被认领,超过重试次数直接进入死信
+	var calls int32
+	w.handler = func(ctx context.Context, job *Job[string]) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}
+	ds = claim()
+	if ds[0].count != 3 {
+		t.Fatalf("deliveries = %d, want 3", ds[0].count)
+	}
+	w.process(ctx, ds[0].msg, ds[0].count)
+	if calls != 0 {
+		t.Fatalf("handler calls = %d, want 0", calls)
+	}
+	waitLen(t, q, 0, 0, 1)
+	jobs, err := q.Dead(ctx, 1)
+	if err != nil || len(jobs) != 1 || jobs[0].Attempt != 3 {
+		t.Fatalf("dead = %+v, %v", jobs, err)
+	}
+}
@@ -0,0 +1,330 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrNotFound 缓存与数据源中都不存在,loader返回该错误时会缓存空结果
+var ErrNotFound = errors.New("redis: not found")
+
+// 缓存值的首字节标记,区分正常值与空结果
+const (
+	markValue    byte = 'v'
+	markNotFound byte = 'n'
+)
+
+type cacheOptions struct {
+	codec       Codec
+	prefix      string
+	negativeTTL time.Duration
+	jitter      float64
+	loadTimeout time.Duration
+}
+
+// CacheOption 缓存选项
+type CacheOption func(*cacheOptions)
+
+// WithCodec 设置编解码,默认JSONCodec
+func WithCodec(codec Codec) CacheOption {
+	return func(o *cacheOptions) {
+		o.codec = codec
+	}
+}
+
+// WithKeyPrefix 设置key前缀,如 user:
+func WithKeyPrefix(prefix string) CacheOption {
+	return func(o *cacheOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithNegativeTTL 设置空结果的缓存时间,默认1分钟,0表示不缓存空结果
+func WithNegativeTTL(ttl time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithTTLJitter 设置过期时间的随机抖动比例,实际过期时间为 ttl*(1+[0,jitter)),默认0.1
+func WithTTLJitter(jitter float64) CacheOption {
+	return func(o *cacheOptions) {
+		o.jitter = jitter
+	}
+}
+
+// WithLoadTimeout 设置回源的超时时间,默认10秒
+//
+// 并发回源时loader只执行一次且不随单个调用方的ctx取消,以免一个调用方取消导致所有等待者失败
+func WithLoadTimeout(d time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.loadTimeout = d
+	}
+}
+
+// Cache 类型化的旁路缓存
+//
+// 并发未命中同一个key时只有一个请求回源,数据不存在时缓存空结果防止穿透,
+// 过期时间加入随机抖动防止同时过期
+//
+// example:
+//
+//	users := redis.NewCache[User](cli, redis.WithKeyPrefix("user:"))
+//	u, err := users.GetOrLoad(ctx, "1", 10*time.Minute, func(ctx context.Context) (User, error) {
+//	  u, err := db.FindUser(ctx, 1)
+//	  if errors.Is(err, sql.ErrNoRows) {
+//	    return u, redis.ErrNotFound
+//	  }
+//	  return u, err
+//	})
+type Cache[T any] struct {
+	c    *Client
+	opts cacheOptions
+	sf   singleflight.Group
+}
+
+// NewCache 创建缓存
+func NewCache[T any](c *Client, opts ...CacheOption) *Cache[T] {
+	o := cacheOptions{
+		codec:       JSONCodec{},
+		negativeTTL: time.Minute,
+		jitter:      0.1,
+		loadTimeout: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Cache[T]{c: c, opts: o}
+}
+
+func (c *Cache[T]) key(key string) string {
+	return c.opts.prefix + key
+}
+
+// ttl 加入随机抖动后的过期时间
+func (c *Cache[T]) ttl(ttl time.Duration) time.Duration {
+	if c.opts.jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Float64()*c.opts.jitter*float64(ttl))
+}
+
+func (c *Cache[T]) encode(v T) ([]byte, error) {
+	b, err := c.opts.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{markValue}, b...), nil
+}
+
+// decode 解码缓存值,空结果返回ErrNotFound
+func (c *Cache[T]) decode(b []byte) (T, error) {
+	var v T
+	if len(b) == 0 {
+		return v, errors.New("redis: empty cache value")
+	}
+	if b[0] == markNotFound {
+		return v, ErrNotFound
+	}
+	err := c.opts.codec.Unmarshal(b[1:], &v)
+	return v, err
+}
+
+// Get 获取缓存,未命中或空结果时返回ErrNotFound
+func (c *Cache[T]) Get(ctx context.Context, key string) (T, error) {
+	v, hit, err := c.get(ctx, key)
+	if err == nil && !hit {
+		err = ErrNotFound
+	}
+	return v, err
+}
+
+// get 获取缓存,hit表示命中了缓存值或空结果,命中空结果时返回ErrNotFound
+func (c *Cache[T]) get(ctx context.Context, key string) (v T, hit bool, err error) {
+	b, err := c.c.Get(ctx, c.key(key)).Bytes()
+	if err == redis.Nil {
+		return v, false, nil
+	}
+	if err != nil {
+		return v, false, err
+	}
+	v, err = c.decode(b)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		// 无法解码的旧数据按未命中处理
+		return v, false, nil
+	}
+	return v, true, err
+}
+
+// Set 设置缓存,过期时间会加入随机抖动
+func (c *Cache[T]) Set(ctx context.Context, key string, v T, ttl time.Duration) error {
+	b, err := c.encode(v)
+	if err != nil {
+		return err
+	}
+	return c.c.Set(ctx, c.key(key), b, c.ttl(ttl)).Err()
+}
+
+// setNotFound 缓存空结果
+func (c *Cache[T]) setNotFound(ctx context.Context, key string) error {
+	if c.opts.negativeTTL <= 0 {
+		return nil
+	}
+	return c.c.Set(ctx, c.key(key), []byte{markNotFound}, c.ttl(c.opts.negativeTTL)).Err()
+}
+
+// Delete 删除缓存
+func (c *Cache[T]) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	// 逐个删除,集群模式下这些key可能不在同一个slot
+	pipe := c.c.Pipeline()
+	for _, k := range keys {
+		pipe.Del(ctx, c.key(k))
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetOrLoad 获取缓存,未命中时调用loader回源并写入缓存
+//
+// loader返回ErrNotFound时缓存空结果,之后的调用在空结果过期前直接返回ErrNotFound
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	if v, hit, err := c.get(ctx, key); hit {
+		return v, err
+	}
+	return c.load(ctx, key, ttl, loader)
+}
+
+// load 回源并写入缓存,并发回源同一个key时只调用一次loader
+func (c *Cache[T]) load(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	ch := c.sf.DoChan(key, func() (any, error) {
+		ctx, cancel := c.loadContext(ctx)
+		defer cancel()
+		v, err := loader(ctx)
+		if errors.Is(err, ErrNotFound) {
+			_ = c.setNotFound(ctx, key)
+			return v, err
+		}
+		if err != nil {
+			return v, err
+		}
+		// 写缓存失败不影响本次返回
+		_ = c.Set(ctx, key, v, ttl)
+		return v, nil
+	})
+	select {
+	case res := <-ch:
+		// T为接口类型且loader返回nil时断言失败,返回零值
+		v, _ := res.Val.(T)
+		return v, res.Err
+	case <-ctx.Done():
+		var v T
+		return v, ctx.Err()
+	}
+}
+
+// loadContext 回源使用的ctx,保留ctx中的值但不随其取消
+func (c *Cache[T]) loadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{ctx}, c.opts.loadTimeout)
+}
+
+// detachedContext 保留父ctx中的值,但没有截止时间也不会被取消
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (d detachedContext) Value(key any) any         { return d.parent.Value(key) }
+
+// MGetOrLoad 批量获取缓存,未命中的key一次交给loader回源
+//
+// loader返回的map中不存在的key视为数据不存在并缓存空结果,返回值只包含存在的key
+func (c *Cache[T]) MGetOrLoad(ctx context.Context, keys []string, ttl time.Duration, loader func(ctx context.Context, missing []string) (map[string]T, error)) (map[string]T, error) {
+	res := make(map[string]T, len(keys))
+	if len(keys) == 0 {
+		return res, nil
+	}
+	// 使用pipeline逐个读取而不是MGET,集群模式下这些key可能不在同一个slot
+	pipe := c.c.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, k := range keys {
+		cmds[i] = pipe.Get(ctx, c.key(k))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var missing []string
+	for i, cmd := range cmds {
+		b, err := cmd.Bytes()
+		if err == redis.Nil {
+			missing = append(missing, keys[i])
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		v, err := c.decode(b)
+		switch {
+		case err == nil:
+			res[keys[i]] = v
+		case errors.Is(err, ErrNotFound):
+		default:
+			// 无法解码的旧数据按未命中处理
+			missing = append(missing, keys[i])
+		}
+	}
+	if len(missing) == 0 {
+		return res, nil
+	}
+
+	sort.Strings(missing)
+	ch := c.sf.DoChan("\x00batch:"+strings.Join(missing, "\x00"), func() (any, error) {
+		ctx, cancel := c.loadContext(ctx)
+		defer cancel()
+		m, err := loader(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		pipe := c.c.Pipeline()
+		for _, k := range missing {
+			if v, ok := m[k]; ok {
+				b, err := c.encode(v)
+				if err != nil {
+					return nil, err
+				}
+				pipe.Set(ctx, c.key(k), b, c.ttl(ttl))
+			} else if c.opts.negativeTTL > 0 {
+				pipe.Set(ctx, c.key(k), []byte{markNotFound}, c.ttl(c.opts.negativeTTL))
+			}
+		}
+		// 写缓存失败不影响本次返回
+		_, _ = pipe.Exec(ctx)
+		return m, nil
+	})
+	var loaded map[string]T
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		loaded, _ = r.Val.(map[string]T)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	for k, v := range loaded {
+		res[k] = v
+	}
+	return res, nil
+}
@@ -0,0 +1,171 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type cacheUser struct {
+	Name string `json:"name"`
+}
+
+func TestCache_NegativeCaching(t *testing.T) {
+	c, mr := newTestClient(t)
+	users := NewCache[cacheUser](c, WithKeyPrefix("user:"), WithNegativeTTL(time.Minute), WithTTLJitter(0))
+	ctx := context.Background()
+
+	var calls int32
+	loader := func(ctx context.Context) (cacheUser, error) {
+		atomic.AddInt32(&calls, 1)
+		return cacheUser{}, ErrNotFound
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := users.GetOrLoad(ctx, "1", time.Minute, loader); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get missing user = %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("loader calls = %d, want 1", calls)
+	}
+	if _, err := users.Get(ctx, "1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get negative entry = %v", err)
+	}
+
+	// 空结果过期后重新回源
+	mr.FastForward(2 * time.Minute)
+	u, err := users.GetOrLoad(ctx, "1", time.Minute, func(ctx context.Context) (cacheUser, error) {
+		return cacheUser{Name: "tom"}, nil
+	})
+	if err != nil || u.Name != "tom" {
+		t.Fatalf("get after negative expired = %+v, %v", u, err)
+	}
+	if ttl := mr.TTL("user:1"); ttl != time.Minute {
+		t.Fatalf("ttl = %s", ttl)
+	}
+}
+
+func TestCache_TTLJitter(t *testing.T) {
+	cache := NewCache[cacheUser](nil, WithTTLJitter(0.2))
+	for i := 0; i < 1000; i++ {
+		if ttl := cache.ttl(time.Minute); ttl < time.Minute || ttl >= 72*time.Second {
+			t.Fatalf("ttl with jitter = %s", ttl)
+		}
+	}
+	if ttl := NewCache[cacheUser](nil, WithTTLJitter(0)).ttl(time.Minute); ttl != time.Minute {
+		t.Fatalf("ttl without jitter = %s", ttl)
+	}
+}
+
+func TestCache_CollapseMisses(t *testing.T) {
+	c, _ := newTestClient(t)
+	users := NewCache[cacheUser](c)
+
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (cacheUser, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		// 回源不随调用方的ctx取消
+		if err := ctx.Err(); err != nil {
+			return cacheUser{}, err
+		}
+		return cacheUser{Name: "tom"}, nil
+	}
+
+	// 第一个调用方取消,不影响其他等待者
+	cctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := users.GetOrLoad(cctx, "1", time.Minute, loader)
+		first <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := users.GetOrLoad(context.Background(), "1", time.Minute, loader)
+			if err == nil && u.Name != "tom" {
+				err = errors.New("unexpected user " + u.Name)
+			}
+			errs <- err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller = %v", err)
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("loader calls = %d, want 1", calls)
+	}
+}
+
+func TestCache_InterfaceNilValue(t *testing.T) {
+	c, _ := newTestClient(t)
+	cache := NewCache[error](c)
+	boom := errors.New("boom")
+	v, err := cache.GetOrLoad(context.Background(), "k", time.Minute, func(ctx context.Context) (error, error) {
+		return nil, boom
+	})
+	if v != nil || !errors.Is(err, boom) {
+		t.Fatalf("get = %v, %v", v, err)
+	}
+}
+
+func TestCache_MGetOrLoad(t *testing.T) {
+	c, mr := newTestClient(t)
+	users := NewCache[cacheUser](c, WithKeyPrefix("user:"))
+	ctx := context.Background()
+	if err := users.Set(ctx, "1", cacheUser{Name: "tom"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	var missing []string
+	loader := func(ctx context.Context, keys []string) (map[string]cacheUser, error) {
+		missing = append(missing, keys...)
+		return map[string]cacheUser{"2": {Name: "jerry"}}, nil
+	}
+	res, err := users.MGetOrLoad(ctx, []string{"1", "2", "3"}, time.Minute, loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res["1"].Name != "tom" || res["2"].Name != "jerry" {
+		t.Fatalf("mget = %+v", res)
+	}
+	if len(missing) != 2 || missing[0] != "2" || missing[1] != "3" {
+		t.Fatalf("loader keys = %v", missing)
+	}
+
+	// 回源结果与空结果都已缓存
+	missing = nil
+	res, err = users.MGetOrLoad(ctx, []string{"1", "2", "3"}, time.Minute, loader)
+	if err != nil || len(res) != 2 || len(missing) != 0 {
+		t.Fatalf("mget cached = %+v, %v, loader keys = %v", res, err, missing)
+	}
+	if _, err = users.Get(ctx, "3"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get negative entry = %v", err)
+	}
+
+	if err = users.Delete(ctx, "1", "2", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if n := mr.DB(0).Keys(); len(n) != 0 {
+		t.Fatalf("keys after delete = %v", n)
+	}
+}
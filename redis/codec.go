@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec 缓存值的编解码
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec JSON编解码
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// MsgpackCodec msgpack编解码,体积比JSON小
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// ProtoCodec protobuf编解码,值必须实现proto.Message,如 Cache[*pb.User]
+type ProtoCodec struct{}
+
+func (ProtoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("redis: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	// Cache[*pb.User]解码时传入的是**pb.User,需要先分配消息
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Pointer {
+		return fmt.Errorf("redis: %T is not a proto.Message", v)
+	}
+	msg := reflect.New(rv.Elem().Type().Elem())
+	m, ok := msg.Interface().(proto.Message)
+	if !ok {
+		return fmt.Errorf("redis: %T is not a proto.Message", v)
+	}
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+	rv.Elem().Set(msg)
+	return nil
+}
@@ -0,0 +1,253 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudneedle/gokit/tools"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrLockNotAcquired 重试结束仍未获得锁
+	ErrLockNotAcquired = errors.New("redis: lock not acquired")
+	// ErrLockNotHeld 锁已过期或被其他持有者获得
+	ErrLockNotHeld = errors.New("redis: lock not held")
+)
+
+// acquireScript 加锁成功时递增并返回fencing token,失败返回0
+//
+// KEYS[1] 锁 KEYS[2] token计数器 ARGV[1] 持有者标识 ARGV[2] 过期时间(毫秒)
+var acquireScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+// releaseScript 仍是持有者时删除锁
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// extendScript 仍是持有者时续期
+var extendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+type lockOptions struct {
+	retryMin   time.Duration // 首次重试间隔
+	retryMax   time.Duration // 最大重试间隔
+	retries    int           // 最大重试次数,小于0时一直重试直到ctx取消
+	autoExtend bool          // 持有期间自动续期
+}
+
+// LockOption 加锁选项
+type LockOption func(*lockOptions)
+
+// WithLockBackoff 设置重试间隔,从min开始每次翻倍直到max,并加入随机抖动,默认50ms到1s
+func WithLockBackoff(min, max time.Duration) LockOption {
+	return func(o *lockOptions) {
+		o.retryMin, o.retryMax = min, max
+	}
+}
+
+// WithLockRetries 设置最大重试次数,0表示只尝试一次,默认一直重试直到ctx取消
+func WithLockRetries(n int) LockOption {
+	return func(o *lockOptions) {
+		o.retries = n
+	}
+}
+
+// WithLockAutoExtend 设置是否在持有期间自动续期,默认开启
+func WithLockAutoExtend(on bool) LockOption {
+	return func(o *lockOptions) {
+		o.autoExtend = on
+	}
+}
+
+// Lock 分布式锁
+//
+// 每次加锁成功都会获得一个单调递增的fencing token,下游写入时携带token并拒绝比已见过的更小的token,
+// 即可防止因GC停顿等原因过期的旧持有者继续写入
+type Lock struct {
+	c     *Client
+	key   string
+	value string
+	token int64
+	ttl   time.Duration
+
+	cancel context.CancelFunc
+	lost   chan struct{}
+	once   sync.Once
+}
+
+// Lock 加锁,ttl为锁的过期时间,获取失败时按退避策略重试
+//
+// 重试次数用尽时返回ErrLockNotAcquired,等待期间ctx取消时返回ctx.Err()
+//
+// fencing token的计数器与锁在同一个slot,key中有hash tag时保存在 <key>:fence,如 {order}:lock:fence,
+// 否则保存在 {<key>}:fence;key中含有}但没有hash tag时集群模式下无法使用
+//
+// example:
+//
+//	lock, err := cli.Lock(ctx, "locks:report", 10*time.Second)
+//	if err != nil {
+//	  return err
+//	}
+//	defer lock.Unlock(context.Background())
+//	saveReport(lock.Token())
+func (c *Client) Lock(ctx context.Context, key string, ttl time.Duration, opts ...LockOption) (*Lock, error) {
+	o := lockOptions{
+		retryMin:   50 * time.Millisecond,
+		retryMax:   time.Second,
+		retries:    -1,
+		autoExtend: true,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	value := tools.GetUUID()
+	backoff := o.retryMin
+	for attempt := 0; ; attempt++ {
+		token, err := acquireScript.Run(ctx, c, []string{key, fenceKey(key)}, value, ttl.Milliseconds()).Int64()
+		if err != nil {
+			return nil, err
+		}
+		if token > 0 {
+			return c.newLock(key, value, token, ttl, o.autoExtend), nil
+		}
+		if o.retries >= 0 && attempt >= o.retries {
+			return nil, ErrLockNotAcquired
+		}
+
+		// 随机抖动,避免多个等待者同时重试
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > o.retryMax {
+			backoff = o.retryMax
+		}
+	}
+}
+
+func (c *Client) newLock(key, value string, token int64, ttl time.Duration, autoExtend bool) *Lock {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Lock{
+		c:      c,
+		key:    key,
+		value:  value,
+		token:  token,
+		ttl:    ttl,
+		cancel: cancel,
+		lost:   make(chan struct{}),
+	}
+	if autoExtend {
+		go l.keepAlive(ctx)
+	}
+	return l
+}
+
+// keepAlive 每隔ttl/3续期一次,续期失败且锁已可能过期时视为丢失
+func (l *Lock) keepAlive(ctx context.Context) {
+	interval := l.ttl / 3
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(l.ttl)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := l.Extend(ctx, l.ttl)
+		switch {
+		case err == nil:
+			deadline = time.Now().Add(l.ttl)
+		case errors.Is(err, ErrLockNotHeld), time.Now().After(deadline):
+			l.markLost()
+			return
+		}
+	}
+}
+
+func (l *Lock) markLost() {
+	l.once.Do(func() {
+		close(l.lost)
+	})
+}
+
+// Key 锁的key
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token fencing token,每次加锁成功单调递增
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Lost 锁丢失时关闭,如续期失败或被释放
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Extend 续期,锁已不再持有时返回ErrLockNotHeld
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	n, err := extendScript.Run(ctx, l.c, []string{l.key}, l.value, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Unlock 释放锁,锁已不再持有时返回ErrLockNotHeld
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.cancel()
+	defer l.markLost()
+	n, err := releaseScript.Run(ctx, l.c, []string{l.key}, l.value).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// fenceKey fencing token计数器的key,与锁的key在同一个slot,集群模式下脚本访问的两个key不会跨slot
+//
+// key中有hash tag时直接追加后缀;没有时用整个key作为hash tag,
+// key中含有}时无法作为hash tag,此时直接追加后缀,集群模式下需要自行在key中使用hash tag
+func fenceKey(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key + ":fence"
+		}
+	}
+	if strings.Contains(key, "}") {
+		return key + ":fence"
+	}
+	return "{" + key + "}:fence"
+}
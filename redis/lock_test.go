@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClient_Lock(t *testing.T) {
+	c, mr := newTestClient(t)
+	ctx := context.Background()
+
+	a, err := c.Lock(ctx, "locks:report", time.Second, WithLockAutoExtend(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Lock(ctx, "locks:report", time.Second, WithLockRetries(0)); !errors.Is(err, ErrLockNotAcquired) {
+		t.Fatalf("lock held key = %v", err)
+	}
+
+	// 等待期间ctx取消返回ctx.Err()
+	cctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err = c.Lock(cctx, "locks:report", time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("lock with cancelled ctx = %v", err)
+	}
+
+	// 续期
+	if err = a.Extend(ctx, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("locks:report"); ttl != 5*time.Second {
+		t.Fatalf("ttl after extend = %s", ttl)
+	}
+
+	if err = a.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-a.Lost():
+	default:
+		t.Fatal("lost should be closed after unlock")
+	}
+	if err = a.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("unlock twice = %v", err)
+	}
+	if err = a.Extend(ctx, time.Second); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("extend released lock = %v", err)
+	}
+
+	// fencing token单调递增
+	b, err := c.Lock(ctx, "locks:report", time.Second, WithLockAutoExtend(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Token() <= a.Token() {
+		t.Fatalf("token %d not greater than %d", b.Token(), a.Token())
+	}
+
+	// 过期后被其他持有者获得,旧持有者无法释放或续期
+	mr.FastForward(2 * time.Second)
+	d, err := c.Lock(ctx, "locks:report", time.Second, WithLockRetries(0), WithLockAutoExtend(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Token() <= b.Token() {
+		t.Fatalf("token %d not greater than %d", d.Token(), b.Token())
+	}
+	if err = b.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("unlock expired lock = %v", err)
+	}
+	if v, _ := mr.Get("locks:report"); v != d.value {
+		t.Fatal("expired holder released the new holder's lock")
+	}
+}
+
+func TestLock_AutoExtend(t *testing.T) {
+	c, mr := newTestClient(t)
+	ctx := context.Background()
+
+	l, err := c.Lock(ctx, "locks:job", 150*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Unlock(ctx)
+	mr.SetTTL("locks:job", time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if ttl := mr.TTL("locks:job"); ttl != 150*time.Millisecond {
+		t.Fatalf("ttl not extended: %s", ttl)
+	}
+
+	// 被他人删除后视为丢失
+	mr.Del("locks:job")
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lost not closed after key was removed")
+	}
+}
+
+func TestFenceKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"locks:report":   "{locks:report}:fence",
+		"{locks}:report": "{locks}:report:fence",
+		"locks:{}":       "locks:{}:fence",
+	} {
+		if got := fenceKey(key); got != want {
+			t.Errorf("fenceKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
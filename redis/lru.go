@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru 进程内的LRU缓存,按条目数或字节数淘汰,条目过期后视为不存在
+type lru[V any] struct {
+	mu         sync.Mutex
+	maxEntries int   // 最大条目数,0表示不限制
+	maxBytes   int64 // 最大字节数,0表示不限制
+	bytes      int64
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key      string
+	value    V
+	size     int64
+	expireAt time.Time
+}
+
+func newLRU[V any](maxEntries int, maxBytes int64) *lru[V] {
+	return &lru[V]{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get 获取未过期的条目
+func (l *lru[V]) Get(key string) (V, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.get(key)
+}
+
+// GetOrSet 获取未过期的条目,不存在时写入fn的返回值
+func (l *lru[V]) GetOrSet(key string, size int64, ttl time.Duration, fn func() V) V {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if v, ok := l.get(key); ok {
+		return v
+	}
+	v := fn()
+	l.set(key, v, size, ttl)
+	return v
+}
+
+func (l *lru[V]) get(key string) (V, bool) {
+	var zero V
+	el, ok := l.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*lruEntry[V])
+	if !e.expireAt.IsZero() && time.Now().After(e.expireAt) {
+		l.remove(el)
+		return zero, false
+	}
+	l.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// Set 写入条目,size为条目占用的字节数,ttl为0时不过期
+func (l *lru[V]) Set(key string, value V, size int64, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.set(key, value, size, ttl)
+}
+
+func (l *lru[V]) set(key string, value V, size int64, ttl time.Duration) {
+	if l.maxBytes > 0 && size > l.maxBytes {
+		// 单个条目超过上限时不缓存
+		if el, ok := l.items[key]; ok {
+			l.remove(el)
+		}
+		return
+	}
+	var expireAt time.Time
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl)
+	}
+	if el, ok := l.items[key]; ok {
+		e := el.Value.(*lruEntry[V])
+		l.bytes += size - e.size
+		e.value, e.size, e.expireAt = value, size, expireAt
+		l.ll.MoveToFront(el)
+	} else {
+		l.items[key] = l.ll.PushFront(&lruEntry[V]{key: key, value: value, size: size, expireAt: expireAt})
+		l.bytes += size
+	}
+	for l.ll.Len() > 0 && (l.maxEntries > 0 && l.ll.Len() > l.maxEntries || l.maxBytes > 0 && l.bytes > l.maxBytes) {
+		l.remove(l.ll.Back())
+	}
+}
+
+// Delete 删除条目
+func (l *lru[V]) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		l.remove(el)
+	}
+}
+
+// Purge 清空
+func (l *lru[V]) Purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ll.Init()
+	l.items = make(map[string]*list.Element)
+	l.bytes = 0
+}
+
+// Len 条目数,包括已过期但尚未淘汰的条目
+func (l *lru[V]) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len()
+}
+
+func (l *lru[V]) remove(el *list.Element) {
+	e := l.ll.Remove(el).(*lruEntry[V])
+	delete(l.items, e.key)
+	l.bytes -= e.size
+}
@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	l := newLRU[string](2, 0)
+	l.Set("a", "1", 1, 0)
+	l.Set("b", "2", 1, 0)
+	l.Get("a")
+	l.Set("c", "3", 1, 0)
+	if _, ok := l.Get("b"); ok {
+		t.Fatal("b should be evicted")
+	}
+	if v, ok := l.Get("a"); !ok || v != "1" {
+		t.Fatalf("a = %q, %v", v, ok)
+	}
+
+	l = newLRU[string](0, 10)
+	l.Set("a", "1", 6, 0)
+	l.Set("b", "2", 6, 0)
+	if _, ok := l.Get("a"); ok {
+		t.Fatal("a should be evicted by size")
+	}
+	l.Set("big", "x", 11, 0)
+	if _, ok := l.Get("big"); ok {
+		t.Fatal("entry larger than limit should not be cached")
+	}
+
+	l.Set("ttl", "1", 1, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := l.Get("ttl"); ok {
+		t.Fatal("ttl should be expired")
+	}
+}
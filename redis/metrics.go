@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector 导出连接池统计
+type poolCollector struct {
+	c *Client
+
+	hits     *prometheus.Desc
+	misses   *prometheus.Desc
+	timeouts *prometheus.Desc
+	total    *prometheus.Desc
+	idle     *prometheus.Desc
+	stale    *prometheus.Desc
+}
+
+// NewPoolCollector 创建连接池指标,name用于区分多个客户端,以 client 标签输出
+//
+// example:
+//
+//	m.Registry().MustRegister(redis.NewPoolCollector(rdb, "cache"))
+func NewPoolCollector(c *Client, name string) prometheus.Collector {
+	labels := prometheus.Labels{"client": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("redis", "pool", metric), help, nil, labels)
+	}
+	return &poolCollector{
+		c:        c,
+		hits:     desc("hits_total", "Number of times a free connection was found in the pool."),
+		misses:   desc("misses_total", "Number of times a free connection was not found in the pool."),
+		timeouts: desc("timeouts_total", "Number of times a wait timeout occurred."),
+		total:    desc("connections", "Number of total connections in the pool."),
+		idle:     desc("idle_connections", "Number of idle connections in the pool."),
+		stale:    desc("stale_connections_total", "Number of stale connections removed from the pool."),
+	}
+}
+
+func (p *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.hits
+	ch <- p.misses
+	ch <- p.timeouts
+	ch <- p.total
+	ch <- p.idle
+	ch <- p.stale
+}
+
+func (p *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := p.c.PoolStats()
+	ch <- prometheus.MustNewConstMetric(p.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(p.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(p.timeouts, prometheus.CounterValue, float64(s.Timeouts))
+	ch <- prometheus.MustNewConstMetric(p.total, prometheus.GaugeValue, float64(s.TotalConns))
+	ch <- prometheus.MustNewConstMetric(p.idle, prometheus.GaugeValue, float64(s.IdleConns))
+	ch <- prometheus.MustNewConstMetric(p.stale, prometheus.CounterValue, float64(s.StaleConns))
+}
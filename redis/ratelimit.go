@@ -0,0 +1,320 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudneedle/gokit/tools"
+	"github.com/redis/go-redis/v9"
+)
+
+// LimitResult 限流结果
+type LimitResult struct {
+	Allowed    bool          // 是否放行
+	Limit      int           // 窗口内的最大请求数或令牌桶容量
+	Remaining  int           // 剩余可用次数
+	ResetAfter time.Duration // 恢复到满额度的时间
+	RetryAfter time.Duration // 被拒绝时距离下次可用的时间
+}
+
+// ErrInvalidLimit 限流参数无效,如令牌桶的rate不大于0
+var ErrInvalidLimit = errors.New("redis: invalid rate limit")
+
+// Limiter 限流器
+type Limiter interface {
+	Allow(ctx context.Context, key string) (LimitResult, error)
+}
+
+type limiterOptions struct {
+	prefix     string
+	fallback   bool
+	maxKeys    int
+	onFallback func(key string, err error)
+}
+
+// LimiterOption 限流器选项
+type LimiterOption func(*limiterOptions)
+
+// WithLimiterPrefix 设置Redis key前缀,默认 ratelimit:
+func WithLimiterPrefix(prefix string) LimiterOption {
+	return func(o *limiterOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithLimiterFallback 设置Redis不可用时是否退化为进程内限流,默认开启;关闭时返回Redis的错误
+func WithLimiterFallback(on bool) LimiterOption {
+	return func(o *limiterOptions) {
+		o.fallback = on
+	}
+}
+
+// WithLimiterOnFallback 设置退化为进程内限流时的回调,用于记录日志或上报指标;
+// 默认使用log输出,每10秒最多一条
+func WithLimiterOnFallback(fn func(key string, err error)) LimiterOption {
+	return func(o *limiterOptions) {
+		o.onFallback = fn
+	}
+}
+
+// WithLimiterLocalKeys 设置进程内限流最多保存的key数量,默认100000
+func WithLimiterLocalKeys(n int) LimiterOption {
+	return func(o *limiterOptions) {
+		o.maxKeys = n
+	}
+}
+
+func newLimiterOptions(opts []LimiterOption) limiterOptions {
+	o := limiterOptions{
+		prefix:   "ratelimit:",
+		fallback: true,
+		maxKeys:  100000,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.onFallback == nil {
+		o.onFallback = logFallback()
+	}
+	return o
+}
+
+// logFallback 输出退化日志,Redis持续不可用时避免每个请求都输出
+func logFallback() func(key string, err error) {
+	var last int64
+	return func(key string, err error) {
+		now := time.Now().UnixNano()
+		prev := atomic.LoadInt64(&last)
+		if now-prev < int64(10*time.Second) || !atomic.CompareAndSwapInt64(&last, prev, now) {
+			return
+		}
+		log.Printf("redis: limiter fallback to local for %s: %v", key, err)
+	}
+}
+
+// slidingWindowScript 滑动窗口日志,窗口内的请求按时间记录在有序集合中
+//
+// KEYS[1] 窗口 ARGV[1] 窗口长度(毫秒) ARGV[2] 最大请求数 ARGV[3] 本次请求的唯一标识
+// 返回 {是否放行, 剩余次数, 最早一次请求离开窗口的时间(毫秒)}
+var slidingWindowScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[3])
+	count = count + 1
+	allowed = 1
+end
+redis.call("PEXPIRE", KEYS[1], window)
+local reset = 0
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - count, reset}
+`)
+
+// tokenBucketScript 令牌桶,按流逝的时间补充令牌
+//
+// KEYS[1] 令牌桶 ARGV[1] 每秒补充的令牌数 ARGV[2] 容量
+// 返回 {是否放行, 剩余令牌, 下个令牌的等待时间(毫秒), 补满的时间(毫秒)}
+var tokenBucketScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1]) or burst
+local ts = tonumber(data[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * 1000 / rate)
+end
+local reset = math.ceil((burst - tokens) * 1000 / rate)
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// SlidingWindow 滑动窗口限流,任意window时间内最多limit次请求
+type SlidingWindow struct {
+	c      *Client
+	limit  int
+	window time.Duration
+	opts   limiterOptions
+	local  *lru[*localWindow]
+}
+
+type localWindow struct {
+	mu   sync.Mutex
+	hits []time.Time
+}
+
+// NewSlidingWindow 创建滑动窗口限流,c为nil时只使用进程内限流
+//
+// example:
+//
+//	// 每个IP每分钟最多100次
+//	limiter := redis.NewSlidingWindow(cli, 100, time.Minute)
+func NewSlidingWindow(c *Client, limit int, window time.Duration, opts ...LimiterOption) *SlidingWindow {
+	o := newLimiterOptions(opts)
+	return &SlidingWindow{
+		c:      c,
+		limit:  limit,
+		window: window,
+		opts:   o,
+		local:  newLRU[*localWindow](o.maxKeys, 0),
+	}
+}
+
+// Allow 记录一次请求并返回是否放行,limit或window不大于0时返回ErrInvalidLimit
+func (s *SlidingWindow) Allow(ctx context.Context, key string) (LimitResult, error) {
+	if s.limit <= 0 || s.window <= 0 {
+		return LimitResult{}, ErrInvalidLimit
+	}
+	if s.c == nil {
+		return s.allowLocal(key), nil
+	}
+	vals, err := slidingWindowScript.Run(ctx, s.c, []string{s.opts.prefix + key},
+		s.window.Milliseconds(), s.limit, tools.GetUUID()).Int64Slice()
+	if err != nil {
+		if s.opts.fallback {
+			s.opts.onFallback(key, err)
+			return s.allowLocal(key), nil
+		}
+		return LimitResult{}, err
+	}
+	res := LimitResult{
+		Allowed:    vals[0] == 1,
+		Limit:      s.limit,
+		Remaining:  int(vals[1]),
+		ResetAfter: time.Duration(vals[2]) * time.Millisecond,
+	}
+	if !res.Allowed {
+		res.RetryAfter = res.ResetAfter
+	}
+	return res, nil
+}
+
+func (s *SlidingWindow) allowLocal(key string) LimitResult {
+	w := s.local.GetOrSet(key, 1, 0, func() *localWindow {
+		return &localWindow{}
+	})
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	i := 0
+	for i < len(w.hits) && now.Sub(w.hits[i]) >= s.window {
+		i++
+	}
+	w.hits = w.hits[i:]
+	res := LimitResult{Limit: s.limit}
+	if len(w.hits) < s.limit {
+		w.hits = append(w.hits, now)
+		res.Allowed = true
+	}
+	res.Remaining = s.limit - len(w.hits)
+	if len(w.hits) > 0 {
+		res.ResetAfter = s.window - now.Sub(w.hits[0])
+	}
+	if !res.Allowed {
+		res.RetryAfter = res.ResetAfter
+	}
+	return res
+}
+
+// TokenBucket 令牌桶限流,每秒补充rate个令牌,最多积攒burst个,允许一定的突发
+type TokenBucket struct {
+	c     *Client
+	rate  float64
+	burst int
+	opts  limiterOptions
+	local *lru[*localBucket]
+}
+
+type localBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	ts     time.Time
+}
+
+// NewTokenBucket 创建令牌桶限流,c为nil时只使用进程内限流
+//
+// example:
+//
+//	// 平均每秒10次,最多突发20次
+//	limiter := redis.NewTokenBucket(cli, 10, 20)
+func NewTokenBucket(c *Client, rate float64, burst int, opts ...LimiterOption) *TokenBucket {
+	o := newLimiterOptions(opts)
+	return &TokenBucket{
+		c:     c,
+		rate:  rate,
+		burst: burst,
+		opts:  o,
+		local: newLRU[*localBucket](o.maxKeys, 0),
+	}
+}
+
+// Allow 取一个令牌并返回是否放行,rate或burst不大于0时返回ErrInvalidLimit
+func (b *TokenBucket) Allow(ctx context.Context, key string) (LimitResult, error) {
+	if !(b.rate > 0) || b.burst <= 0 {
+		return LimitResult{}, ErrInvalidLimit
+	}
+	if b.c == nil {
+		return b.allowLocal(key), nil
+	}
+	vals, err := tokenBucketScript.Run(ctx, b.c, []string{b.opts.prefix + key},
+		strconv.FormatFloat(b.rate, 'f', -1, 64), b.burst).Int64Slice()
+	if err != nil {
+		if b.opts.fallback {
+			b.opts.onFallback(key, err)
+			return b.allowLocal(key), nil
+		}
+		return LimitResult{}, err
+	}
+	return LimitResult{
+		Allowed:    vals[0] == 1,
+		Limit:      b.burst,
+		Remaining:  int(vals[1]),
+		RetryAfter: time.Duration(vals[2]) * time.Millisecond,
+		ResetAfter: time.Duration(vals[3]) * time.Millisecond,
+	}, nil
+}
+
+func (b *TokenBucket) allowLocal(key string) LimitResult {
+	bucket := b.local.GetOrSet(key, 1, 0, func() *localBucket {
+		return &localBucket{tokens: float64(b.burst), ts: time.Now()}
+	})
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	now := time.Now()
+	bucket.tokens = math.Min(float64(b.burst), bucket.tokens+now.Sub(bucket.ts).Seconds()*b.rate)
+	bucket.ts = now
+	res := LimitResult{Limit: b.burst}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - bucket.tokens) / b.rate * float64(time.Second))
+	}
+	res.Remaining = int(bucket.tokens)
+	res.ResetAfter = time.Duration((float64(b.burst) - bucket.tokens) / b.rate * float64(time.Second))
+	return res
+}
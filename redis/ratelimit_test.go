@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLocalLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	sw := NewSlidingWindow(nil, 2, 50*time.Millisecond)
+	for i, want := range []bool{true, true, false} {
+		res, err := sw.Allow(ctx, "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != want {
+			t.Fatalf("sliding window #%d allowed = %v", i, res.Allowed)
+		}
+	}
+	time.Sleep(60 * time.Millisecond)
+	if res, _ := sw.Allow(ctx, "k"); !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("after window = %+v", res)
+	}
+
+	tb := NewTokenBucket(nil, 100, 1)
+	if res, _ := tb.Allow(ctx, "k"); !res.Allowed {
+		t.Fatal("first token should be allowed")
+	}
+	res, _ := tb.Allow(ctx, "k")
+	if res.Allowed || res.RetryAfter <= 0 {
+		t.Fatalf("empty bucket = %+v", res)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if res, _ := tb.Allow(ctx, "k"); !res.Allowed {
+		t.Fatal("token should be refilled")
+	}
+}
+
+func TestLimiter_Redis(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+
+	sw := NewSlidingWindow(c, 2, time.Minute)
+	for i, want := range []bool{true, true, false} {
+		res, err := sw.Allow(ctx, "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != want || res.Limit != 2 {
+			t.Fatalf("sliding window #%d = %+v", i, res)
+		}
+	}
+
+	tb := NewTokenBucket(c, 1, 2)
+	for i, want := range []bool{true, true, false} {
+		res, err := tb.Allow(ctx, "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != want {
+			t.Fatalf("token bucket #%d = %+v", i, res)
+		}
+	}
+}
+
+func TestLimiter_Invalid(t *testing.T) {
+	ctx := context.Background()
+	for _, l := range []Limiter{
+		NewTokenBucket(nil, 0, 10),
+		NewTokenBucket(nil, 1, 0),
+		NewSlidingWindow(nil, 0, time.Minute),
+		NewSlidingWindow(nil, 10, 0),
+	} {
+		if _, err := l.Allow(ctx, "k"); !errors.Is(err, ErrInvalidLimit) {
+			t.Fatalf("%T allow = %v", l, err)
+		}
+	}
+}
+
+func TestLimiter_Fallback(t *testing.T) {
+	c, mr := newTestClient(t)
+	mr.Close()
+	ctx := context.Background()
+
+	var keys []string
+	tb := NewTokenBucket(c, 1, 1, WithLimiterOnFallback(func(key string, err error) {
+		keys = append(keys, key)
+	}))
+	if res, err := tb.Allow(ctx, "k"); err != nil || !res.Allowed {
+		t.Fatalf("fallback allow = %+v, %v", res, err)
+	}
+	if len(keys) != 1 || keys[0] != "k" {
+		t.Fatalf("fallback keys = %v", keys)
+	}
+
+	if _, err := NewTokenBucket(c, 1, 1, WithLimiterFallback(false)).Allow(ctx, "k"); err == nil {
+		t.Fatal("allow without fallback should fail")
+	}
+}
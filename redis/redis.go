@@ -2,8 +2,13 @@ package redis
 
 import "github.com/redis/go-redis/v9"
 
+// Client Redis客户端,单机、哨兵与集群模式共用同一套命令
+//
+// 命令通过内嵌的redis.UniversalClient执行;单机与哨兵模式下Client字段为底层的*redis.Client,
+// 兼容原先通过c.Client访问或传递*redis.Client的用法,集群模式下为nil
 type Client struct {
-	*redis.Client
+	redis.UniversalClient
+	Client *redis.Client
 }
 
 type Options struct {
@@ -15,9 +20,23 @@ type Options struct {
 const Nil = redis.Nil
 
 func NewClient(options Options) *Client {
-	return &Client{redis.NewClient(&redis.Options{
+	return wrap(redis.NewClient(&redis.Options{
 		Addr:     options.Addr,
 		Password: options.Password,
 		DB:       options.DB,
-	})}
+	}))
+}
+
+// wrap 包装客户端,单机与哨兵模式下同时设置Client字段
+func wrap(u redis.UniversalClient) *Client {
+	rc, _ := u.(*redis.Client)
+	return &Client{UniversalClient: u, Client: rc}
+}
+
+// Options 返回单机或哨兵模式下的客户端选项,集群模式返回nil
+func (c *Client) Options() *redis.Options {
+	if c.Client != nil {
+		return c.Client.Options()
+	}
+	return nil
 }
@@ -0,0 +1,16 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestClient 连接到内存中的Redis
+func newTestClient(t *testing.T) (*Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	c := NewClient(Options{Addr: mr.Addr()})
+	t.Cleanup(func() { c.Close() })
+	return c, mr
+}
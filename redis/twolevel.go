@@ -0,0 +1,363 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudneedle/gokit/tools"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultInvalidateChannel 默认的失效广播频道
+const DefaultInvalidateChannel = "gokit:cache:invalidate"
+
+// generationStripes 失效版本号的分段数,按key哈希分段
+const generationStripes = 64
+
+type twoLevelOptions struct {
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	channel    string
+}
+
+// TwoLevelOption 二级缓存选项
+type TwoLevelOption func(*twoLevelOptions)
+
+// WithLocalEntries 设置本地缓存的最大条目数,默认10000,0表示不限制
+func WithLocalEntries(n int) TwoLevelOption {
+	return func(o *twoLevelOptions) {
+		o.maxEntries = n
+	}
+}
+
+// WithLocalBytes 设置本地缓存的最大字节数,按编码后的大小计算,默认不限制
+func WithLocalBytes(n int64) TwoLevelOption {
+	return func(o *twoLevelOptions) {
+		o.maxBytes = n
+	}
+}
+
+// WithLocalTTL 设置本地缓存的过期时间,默认1分钟,作为丢失失效广播时的兜底
+func WithLocalTTL(ttl time.Duration) TwoLevelOption {
+	return func(o *twoLevelOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithInvalidateChannel 设置失效广播的频道,默认DefaultInvalidateChannel
+func WithInvalidateChannel(channel string) TwoLevelOption {
+	return func(o *twoLevelOptions) {
+		o.channel = channel
+	}
+}
+
+// CacheStats 各级缓存的命中统计
+type CacheStats struct {
+	LocalHits    uint64 `json:"local_hits"`
+	LocalMisses  uint64 `json:"local_misses"`
+	RemoteHits   uint64 `json:"remote_hits"`
+	RemoteMisses uint64 `json:"remote_misses"`
+}
+
+// localValue 本地缓存的值,notFound表示缓存的空结果
+type localValue[T any] struct {
+	v        T
+	notFound bool
+}
+
+// invalidation 失效广播的消息
+type invalidation struct {
+	ID   string   `json:"id"`   // 发送方实例,忽略自己发出的消息
+	Keys []string `json:"keys"` // 带前缀的完整key
+}
+
+// TwoLevel 二级缓存,进程内LRU在前,Redis在后
+//
+// 写入和删除时通过Redis pub/sub广播失效消息,其他实例收到后删除本地缓存;
+// 订阅断开重连后会清空本地缓存,避免错过的消息导致读到旧值
+//
+// example:
+//
+//	users := redis.NewTwoLevel(redis.NewCache[User](cli, redis.WithKeyPrefix("user:")),
+//	  redis.WithLocalEntries(1000), redis.WithLocalTTL(30*time.Second))
+//	defer users.Close()
+//	u, err := users.GetOrLoad(ctx, "1", 10*time.Minute, loadUser)
+type TwoLevel[T any] struct {
+	remote *Cache[T]
+	local  *lru[localValue[T]]
+	opts   twoLevelOptions
+	id     string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// 失效版本号,回源期间key被失效时放弃回填本地缓存
+	mu    sync.Mutex
+	epoch uint64                    // 清空本地缓存时递增
+	gens  [generationStripes]uint64 // 删除key时递增所在分段
+
+	localHits    uint64
+	localMisses  uint64
+	remoteHits   uint64
+	remoteMisses uint64
+}
+
+// NewTwoLevel 创建二级缓存并开始订阅失效广播,不再使用时调用Close
+func NewTwoLevel[T any](remote *Cache[T], opts ...TwoLevelOption) *TwoLevel[T] {
+	o := twoLevelOptions{
+		maxEntries: 10000,
+		ttl:        time.Minute,
+		channel:    DefaultInvalidateChannel,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &TwoLevel[T]{
+		remote: remote,
+		local:  newLRU[localValue[T]](o.maxEntries, o.maxBytes),
+		opts:   o,
+		id:     tools.GetUUID(),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go t.subscribe(ctx)
+	return t
+}
+
+// subscribe 接收失效广播,直到Close
+func (t *TwoLevel[T]) subscribe(ctx context.Context) {
+	defer close(t.done)
+	ps := t.remote.c.Subscribe(ctx, t.opts.channel)
+	// Receive阻塞读取时不响应ctx取消,关闭连接使其返回
+	go func() {
+		<-ctx.Done()
+		ps.Close()
+	}()
+	for {
+		msg, err := ps.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// 连接断开期间可能错过消息
+			t.purgeLocal()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			// 首次订阅或重连后重新订阅
+			t.purgeLocal()
+		case *redis.Message:
+			var inv invalidation
+			if err := json.Unmarshal([]byte(m.Payload), &inv); err != nil || inv.ID == t.id {
+				continue
+			}
+			t.deleteLocal(inv.Keys...)
+		}
+	}
+}
+
+// Close 停止订阅失效广播
+func (t *TwoLevel[T]) Close() error {
+	t.cancel()
+	<-t.done
+	return nil
+}
+
+// Stats 命中统计
+func (t *TwoLevel[T]) Stats() CacheStats {
+	return CacheStats{
+		LocalHits:    atomic.LoadUint64(&t.localHits),
+		LocalMisses:  atomic.LoadUint64(&t.localMisses),
+		RemoteHits:   atomic.LoadUint64(&t.remoteHits),
+		RemoteMisses: atomic.LoadUint64(&t.remoteMisses),
+	}
+}
+
+// getLocal 读取本地缓存,命中空结果时返回ErrNotFound
+func (t *TwoLevel[T]) getLocal(key string) (T, bool, error) {
+	lv, ok := t.local.Get(t.remote.key(key))
+	if !ok {
+		atomic.AddUint64(&t.localMisses, 1)
+		return lv.v, false, nil
+	}
+	atomic.AddUint64(&t.localHits, 1)
+	if lv.notFound {
+		return lv.v, true, ErrNotFound
+	}
+	return lv.v, true, nil
+}
+
+func stripe(full string) int {
+	h := fnv.New32a()
+	h.Write([]byte(full))
+	return int(h.Sum32() % generationStripes)
+}
+
+// generation 返回key当前的失效版本号,epoch与分段计数都只增不减,二者之和变化即表示发生过失效
+func (t *TwoLevel[T]) generation(key string) uint64 {
+	i := stripe(t.remote.key(key))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.epoch + t.gens[i]
+}
+
+// deleteLocal 删除本地缓存,并使正在回源的同名key放弃回填
+func (t *TwoLevel[T]) deleteLocal(fulls ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, full := range fulls {
+		t.gens[stripe(full)]++
+		t.local.Delete(full)
+	}
+}
+
+// purgeLocal 清空本地缓存,并使所有正在回源的key放弃回填
+func (t *TwoLevel[T]) purgeLocal() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.epoch++
+	t.local.Purge()
+}
+
+// fillLocal 回填本地缓存,gen之后key被失效过时不回填,避免缓存失效前读到的旧值
+func (t *TwoLevel[T]) fillLocal(key string, gen uint64, v T, notFound bool) {
+	full := t.remote.key(key)
+	i := stripe(full)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.epoch+t.gens[i] != gen {
+		return
+	}
+	t.setLocal(key, v, notFound)
+}
+
+// setLocal 写入本地缓存,设置了字节上限时按编码后的大小计算
+func (t *TwoLevel[T]) setLocal(key string, v T, notFound bool) {
+	full := t.remote.key(key)
+	size := int64(len(full))
+	if t.opts.maxBytes > 0 && !notFound {
+		b, err := t.remote.opts.codec.Marshal(v)
+		if err != nil {
+			return
+		}
+		size += int64(len(b))
+	}
+	ttl := t.opts.ttl
+	if notFound && t.remote.opts.negativeTTL < ttl {
+		ttl = t.remote.opts.negativeTTL
+	}
+	if notFound && ttl <= 0 {
+		return
+	}
+	t.local.Set(full, localValue[T]{v: v, notFound: notFound}, size, ttl)
+}
+
+// getRemote 读取Redis并回填本地缓存,gen为读取前的失效版本号
+func (t *TwoLevel[T]) getRemote(ctx context.Context, key string, gen uint64) (T, bool, error) {
+	v, hit, err := t.remote.get(ctx, key)
+	if !hit {
+		if err == nil {
+			atomic.AddUint64(&t.remoteMisses, 1)
+		}
+		return v, false, err
+	}
+	atomic.AddUint64(&t.remoteHits, 1)
+	t.fillLocal(key, gen, v, errors.Is(err, ErrNotFound))
+	return v, true, err
+}
+
+// Get 获取缓存,依次查询本地与Redis,未命中或空结果时返回ErrNotFound
+func (t *TwoLevel[T]) Get(ctx context.Context, key string) (T, error) {
+	if v, hit, err := t.getLocal(key); hit {
+		return v, err
+	}
+	v, hit, err := t.getRemote(ctx, key, t.generation(key))
+	if err == nil && !hit {
+		err = ErrNotFound
+	}
+	return v, err
+}
+
+// GetOrLoad 获取缓存,两级都未命中时调用loader回源并写入两级缓存
+func (t *TwoLevel[T]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	if v, hit, err := t.getLocal(key); hit {
+		return v, err
+	}
+	// 在读取Redis之前记录版本号,回源期间收到的失效广播会使回填作废
+	gen := t.generation(key)
+	if v, hit, err := t.getRemote(ctx, key, gen); hit {
+		return v, err
+	}
+	v, err := t.remote.load(ctx, key, ttl, loader)
+	switch {
+	case err == nil:
+		t.fillLocal(key, gen, v, false)
+	case errors.Is(err, ErrNotFound):
+		t.fillLocal(key, gen, v, true)
+	}
+	return v, err
+}
+
+// Set 写入两级缓存并通知其他实例失效
+func (t *TwoLevel[T]) Set(ctx context.Context, key string, v T, ttl time.Duration) error {
+	if err := t.remote.Set(ctx, key, v, ttl); err != nil {
+		t.deleteLocal(t.remote.key(key))
+		return err
+	}
+	// 本实例的写入使并发回源读到的旧值作废
+	t.mu.Lock()
+	t.gens[stripe(t.remote.key(key))]++
+	t.setLocal(key, v, false)
+	t.mu.Unlock()
+	return t.publish(ctx, key)
+}
+
+// Delete 删除两级缓存并通知其他实例失效
+func (t *TwoLevel[T]) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	t.deleteLocal(t.fullKeys(keys)...)
+	if err := t.remote.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	return t.publish(ctx, keys...)
+}
+
+// Invalidate 只删除本地缓存并通知其他实例失效,用于数据源已变更但由其他途径更新Redis的场景
+func (t *TwoLevel[T]) Invalidate(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	t.deleteLocal(t.fullKeys(keys)...)
+	return t.publish(ctx, keys...)
+}
+
+func (t *TwoLevel[T]) fullKeys(keys []string) []string {
+	fulls := make([]string, len(keys))
+	for i, k := range keys {
+		fulls[i] = t.remote.key(k)
+	}
+	return fulls
+}
+
+func (t *TwoLevel[T]) publish(ctx context.Context, keys ...string) error {
+	inv := invalidation{ID: t.id, Keys: t.fullKeys(keys)}
+	b, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	return t.remote.c.Publish(ctx, t.opts.channel, b).Err()
+}
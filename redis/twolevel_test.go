@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTwoLevel_Invalidate(t *testing.T) {
+	c, _ := newTestClient(t)
+	a := NewTwoLevel(NewCache[cacheUser](c, WithKeyPrefix("user:")))
+	defer a.Close()
+	b := NewTwoLevel(NewCache[cacheUser](c, WithKeyPrefix("user:")))
+	defer b.Close()
+	time.Sleep(50 * time.Millisecond)
+	ctx := context.Background()
+
+	if err := a.Set(ctx, "1", cacheUser{Name: "tom"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := b.Get(ctx, "1"); err != nil || u.Name != "tom" {
+		t.Fatalf("get = %+v, %v", u, err)
+	}
+	if err := a.Set(ctx, "1", cacheUser{Name: "jerry"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, hit, _ := b.getLocal("1"); hit {
+		t.Fatal("local entry not invalidated")
+	}
+	if u, err := b.Get(ctx, "1"); err != nil || u.Name != "jerry" {
+		t.Fatalf("get after invalidate = %+v, %v", u, err)
+	}
+}
+
+func TestTwoLevel_InvalidateDuringLoad(t *testing.T) {
+	c, _ := newTestClient(t)
+	a := NewTwoLevel(NewCache[cacheUser](c, WithKeyPrefix("user:")))
+	defer a.Close()
+	b := NewTwoLevel(NewCache[cacheUser](c, WithKeyPrefix("user:")))
+	defer b.Close()
+	time.Sleep(50 * time.Millisecond)
+	ctx := context.Background()
+
+	loading, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.GetOrLoad(ctx, "1", time.Minute, func(ctx context.Context) (cacheUser, error) {
+			close(loading)
+			<-release
+			return cacheUser{Name: "stale"}, nil
+		})
+		done <- err
+	}()
+	<-loading
+
+	// 回源期间其他实例更新了数据
+	if err := a.Invalidate(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, hit, _ := b.getLocal("1"); hit {
+		t.Fatal("stale value cached locally after invalidation")
+	}
+}
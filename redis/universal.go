@@ -0,0 +1,178 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudneedle/gokit/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// 部署模式
+const (
+	ModeSingle   = "single"
+	ModeSentinel = "sentinel"
+	ModeCluster  = "cluster"
+)
+
+// UniversalOptions 通用的客户端选项,可通过config绑定
+//
+// Mode为空时自动选择:设置了MasterName使用哨兵模式,多个地址使用集群模式,否则为单机模式
+type UniversalOptions struct {
+	Mode       string   `config:"mode" validate:"omitempty,oneof=single sentinel cluster"`
+	Addrs      []string `config:"addrs" default:"127.0.0.1:6379"` // 单机地址、哨兵地址或集群种子地址
+	MasterName string   `config:"master_name"`                    // 哨兵模式的主节点名称
+	ClientName string   `config:"client_name"`
+
+	Username         string `config:"username"`
+	Password         string `config:"password"`
+	SentinelUsername string `config:"sentinel_username"`
+	SentinelPassword string `config:"sentinel_password"`
+	DB               int    `config:"db"` // 集群模式不支持
+
+	DialTimeout  time.Duration `config:"dial_timeout" default:"5s"`
+	ReadTimeout  time.Duration `config:"read_timeout" default:"3s"`
+	WriteTimeout time.Duration `config:"write_timeout" default:"3s"`
+	MaxRetries   int           `config:"max_retries" default:"3"`
+
+	PoolSize        int           `config:"pool_size"` // 默认每个CPU 10个连接
+	MinIdleConns    int           `config:"min_idle_conns"`
+	MaxIdleConns    int           `config:"max_idle_conns"`
+	PoolTimeout     time.Duration `config:"pool_timeout"`
+	ConnMaxIdleTime time.Duration `config:"conn_max_idle_time"`
+	ConnMaxLifetime time.Duration `config:"conn_max_lifetime"`
+
+	ReadOnly       bool `config:"read_only"`        // 集群或哨兵模式下允许从副本读取
+	RouteByLatency bool `config:"route_by_latency"` // 集群模式下只读命令发往延迟最低的节点
+	RouteRandomly  bool `config:"route_randomly"`   // 集群模式下只读命令随机发往节点
+
+	TLS TLSOptions `config:"tls"`
+}
+
+// TLSOptions TLS选项
+type TLSOptions struct {
+	Enabled            bool   `config:"enabled"`
+	CAFile             string `config:"ca_file"`
+	CertFile           string `config:"cert_file"`
+	KeyFile            string `config:"key_file"`
+	ServerName         string `config:"server_name"`
+	InsecureSkipVerify bool   `config:"insecure_skip_verify"`
+}
+
+// Config 生成tls.Config,未启用时返回nil
+func (o TLSOptions) Config() (*tls.Config, error) {
+	if !o.Enabled {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis: no certificate found in %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// mode 实际使用的部署模式
+func (o UniversalOptions) mode() string {
+	switch {
+	case o.Mode != "":
+		return o.Mode
+	case o.MasterName != "":
+		return ModeSentinel
+	case len(o.Addrs) > 1:
+		return ModeCluster
+	default:
+		return ModeSingle
+	}
+}
+
+// NewUniversal 按选项创建单机、哨兵或集群模式的客户端
+//
+// example:
+//
+//	cli, err := redis.NewUniversal(redis.UniversalOptions{
+//	  Addrs:      []string{"10.0.0.1:26379", "10.0.0.2:26379"},
+//	  MasterName: "mymaster",
+//	  PoolSize:   50,
+//	})
+func NewUniversal(o UniversalOptions) (*Client, error) {
+	tlsConfig, err := o.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+	if len(o.Addrs) == 0 {
+		o.Addrs = []string{"127.0.0.1:6379"}
+	}
+	uo := &redis.UniversalOptions{
+		Addrs:            o.Addrs,
+		ClientName:       o.ClientName,
+		DB:               o.DB,
+		Username:         o.Username,
+		Password:         o.Password,
+		SentinelUsername: o.SentinelUsername,
+		SentinelPassword: o.SentinelPassword,
+		MaxRetries:       o.MaxRetries,
+		DialTimeout:      o.DialTimeout,
+		ReadTimeout:      o.ReadTimeout,
+		WriteTimeout:     o.WriteTimeout,
+		PoolSize:         o.PoolSize,
+		PoolTimeout:      o.PoolTimeout,
+		MinIdleConns:     o.MinIdleConns,
+		MaxIdleConns:     o.MaxIdleConns,
+		ConnMaxIdleTime:  o.ConnMaxIdleTime,
+		ConnMaxLifetime:  o.ConnMaxLifetime,
+		TLSConfig:        tlsConfig,
+		ReadOnly:         o.ReadOnly,
+		RouteByLatency:   o.RouteByLatency,
+		RouteRandomly:    o.RouteRandomly,
+		MasterName:       o.MasterName,
+	}
+
+	switch o.mode() {
+	case ModeSentinel:
+		if o.MasterName == "" {
+			return nil, errors.New("redis: sentinel mode requires master_name")
+		}
+		return wrap(redis.NewFailoverClient(uo.Failover())), nil
+	case ModeCluster:
+		if o.DB != 0 {
+			return nil, errors.New("redis: cluster mode does not support db")
+		}
+		return wrap(redis.NewClusterClient(uo.Cluster())), nil
+	case ModeSingle:
+		return wrap(redis.NewClient(uo.Simple())), nil
+	default:
+		return nil, fmt.Errorf("redis: unknown mode %q", o.Mode)
+	}
+}
+
+// NewFromConfig 从配置读取选项并创建客户端,如 prefix 为 redis/ 时读取 redis/addrs、redis/pool_size 等
+func NewFromConfig(cli *config.Client, prefix string) (*Client, error) {
+	var o UniversalOptions
+	if err := cli.Unmarshal(prefix, &o); err != nil {
+		return nil, err
+	}
+	return NewUniversal(o)
+}
@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudneedle/gokit/config"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	cli, err := config.New(config.WithProvider(config.NewMemory(map[string]string{
+		"redis/addrs":       "10.0.0.1:26379,10.0.0.2:26379",
+		"redis/master_name": "mymaster",
+		"redis/pool_size":   "20",
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	var o UniversalOptions
+	if err = cli.Unmarshal("redis", &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.mode() != ModeSentinel || len(o.Addrs) != 2 || o.PoolSize != 20 || o.DialTimeout != 5*time.Second {
+		t.Fatalf("options = %+v", o)
+	}
+
+	rc, err := NewFromConfig(cli, "redis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	if _, err = NewUniversal(UniversalOptions{Addrs: []string{"a:1", "b:1"}, DB: 1}); err == nil {
+		t.Fatal("cluster mode with db should fail")
+	}
+}
+
+func TestClient_Single(t *testing.T) {
+	single := NewClient(Options{Addr: "127.0.0.1:6379", DB: 2})
+	defer single.Close()
+	if single.Client == nil || single.Options().DB != 2 {
+		t.Fatal("single mode should expose *redis.Client")
+	}
+
+	sentinel, err := NewUniversal(UniversalOptions{Addrs: []string{"a:26379"}, MasterName: "mymaster"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sentinel.Close()
+	if sentinel.Client == nil || sentinel.Options() == nil {
+		t.Fatal("sentinel mode should expose *redis.Client")
+	}
+
+	cluster, err := NewUniversal(UniversalOptions{Addrs: []string{"a:6379", "b:6379"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+	if cluster.Client != nil || cluster.Options() != nil {
+		t.Fatal("cluster mode should not expose *redis.Client")
+	}
+}
@@ -0,0 +1,230 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudneedle/gokit/config"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Instance 服务实例
+type Instance struct {
+	ID       string            `json:"id"`                 // 实例ID,同一服务内唯一
+	Name     string            `json:"name"`               // 服务名
+	Addr     string            `json:"addr"`               // 实例地址,如 10.0.0.1:8080
+	Metadata map[string]string `json:"metadata,omitempty"` // 附加信息,如版本、机房
+}
+
+// Registry 基于ETCD的服务注册
+//
+// 实例注册在 <prefix><服务名>/<实例ID> 下并绑定租约,进程退出未注销时租约过期后自动删除
+type Registry struct {
+	etcd   *config.Etcd
+	prefix string
+	ttl    time.Duration
+
+	mu         sync.Mutex
+	registered map[string]context.CancelFunc // 实例key -> 停止续约
+}
+
+// Option 服务注册选项
+type Option func(*Registry)
+
+// WithPrefix 设置注册的key前缀,默认 /services/
+func WithPrefix(prefix string) Option {
+	return func(r *Registry) {
+		r.prefix = prefix
+	}
+}
+
+// WithTTL 设置租约时间,默认10秒,不足1秒的部分向上取整
+func WithTTL(ttl time.Duration) Option {
+	return func(r *Registry) {
+		r.ttl = ttl
+	}
+}
+
+// New 创建服务注册
+func New(etcd *config.Etcd, opts ...Option) *Registry {
+	r := &Registry{
+		etcd:       etcd,
+		prefix:     "/services/",
+		ttl:        10 * time.Second,
+		registered: make(map[string]context.CancelFunc),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if !strings.HasSuffix(r.prefix, "/") {
+		r.prefix += "/"
+	}
+	return r
+}
+
+// key 实例对应的key
+func (r *Registry) key(ins Instance) string {
+	return r.servicePrefix(ins.Name) + ins.ID
+}
+
+// servicePrefix 服务下所有实例的key前缀
+func (r *Registry) servicePrefix(name string) string {
+	return r.prefix + name + "/"
+}
+
+// Register 注册实例并在后台续约,租约丢失时自动重新注册,直到Deregister
+func (r *Registry) Register(ctx context.Context, ins Instance) error {
+	if ins.Name == "" || ins.ID == "" || ins.Addr == "" {
+		return errors.New("registry: instance name, id and addr are required")
+	}
+	val, err := json.Marshal(ins)
+	if err != nil {
+		return err
+	}
+	key := r.key(ins)
+
+	r.mu.Lock()
+	if _, ok := r.registered[key]; ok {
+		r.mu.Unlock()
+		return fmt.Errorf("registry: instance %s already registered", key)
+	}
+	keepCtx, cancel := context.WithCancel(context.Background())
+	r.registered[key] = cancel
+	r.mu.Unlock()
+
+	ch, err := r.grant(ctx, keepCtx, key, string(val))
+	if err != nil {
+		r.mu.Lock()
+		delete(r.registered, key)
+		r.mu.Unlock()
+		cancel()
+		return err
+	}
+	go r.keepAlive(keepCtx, key, string(val), ch)
+	return nil
+}
+
+// grant 创建租约并写入实例,返回续约应答
+func (r *Registry) grant(ctx, keepCtx context.Context, key, val string) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	cli := r.etcd.Client()
+	lease, err := cli.Grant(ctx, r.leaseTTL())
+	if err != nil {
+		return nil, err
+	}
+	if _, err = cli.Put(ctx, key, val, clientv3.WithLease(lease.ID)); err != nil {
+		return nil, err
+	}
+	return cli.KeepAlive(keepCtx, lease.ID)
+}
+
+// leaseTTL 租约秒数,向上取整且至少为1秒
+func (r *Registry) leaseTTL() int64 {
+	ttl := int64((r.ttl + time.Second - 1) / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	return ttl
+}
+
+// keepAlive 消费续约应答,续约中断时每秒重试重新注册,直到注销或客户端关闭
+func (r *Registry) keepAlive(ctx context.Context, key, val string, ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	for {
+		for range ch {
+		}
+		for {
+			if ctx.Err() != nil || r.etcd.Client().Ctx().Err() != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			grantCtx, cancel := context.WithTimeout(ctx, r.ttl)
+			next, err := r.grant(grantCtx, ctx, key, val)
+			cancel()
+			if err == nil {
+				ch = next
+				break
+			}
+		}
+	}
+}
+
+// Deregister 注销实例,停止续约并删除key
+func (r *Registry) Deregister(ctx context.Context, ins Instance) error {
+	key := r.key(ins)
+	r.mu.Lock()
+	cancel, ok := r.registered[key]
+	delete(r.registered, key)
+	r.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	_, err := r.etcd.Client().Delete(ctx, key)
+	return err
+}
+
+// Instances 获取服务当前的所有实例
+func (r *Registry) Instances(ctx context.Context, name string) ([]Instance, error) {
+	list, _, err := r.instances(ctx, name)
+	return list, err
+}
+
+// instances 获取服务当前的所有实例及读取时的版本
+func (r *Registry) instances(ctx context.Context, name string) ([]Instance, int64, error) {
+	resp, err := r.etcd.Client().Get(ctx, r.servicePrefix(name), clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	list := make([]Instance, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		ins, err := decodeInstance(kv.Value)
+		if err != nil {
+			continue
+		}
+		list = append(list, ins)
+	}
+	return list, resp.Header.Revision, nil
+}
+
+// decodeInstance 解析实例,缺少必要字段时返回错误
+func decodeInstance(b []byte) (Instance, error) {
+	var ins Instance
+	if err := json.Unmarshal(b, &ins); err != nil {
+		return Instance{}, err
+	}
+	if ins.ID == "" || ins.Addr == "" {
+		return Instance{}, errors.New("registry: instance id and addr are required")
+	}
+	return ins, nil
+}
+
+// AdvertiseAddr 补全监听地址中的IP,如 :8080 -> 10.0.0.1:8080,使用第一个非回环的IPv4地址
+func AdvertiseAddr(host string) (string, error) {
+	h, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return "", err
+	}
+	if h != "" && h != "0.0.0.0" && h != "::" {
+		return host, nil
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
+			continue
+		}
+		return net.JoinHostPort(ipNet.IP.String(), port), nil
+	}
+	return net.JoinHostPort("127.0.0.1", port), nil
+}
@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cloudneedle/gokit/config"
+)
+
+func TestDecodeInstance(t *testing.T) {
+	ins := Instance{ID: "1", Name: "user", Addr: "10.0.0.1:8080", Metadata: map[string]string{"zone": "cn"}}
+	b, err := json.Marshal(ins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeInstance(b)
+	if err != nil || got.Addr != ins.Addr || got.Metadata["zone"] != "cn" {
+		t.Fatalf("decode = %+v, %v", got, err)
+	}
+	if _, err = decodeInstance([]byte(`{"id":"1"}`)); err == nil {
+		t.Fatal("decode instance without addr should fail")
+	}
+	if _, err = decodeInstance([]byte(`not json`)); err == nil {
+		t.Fatal("decode invalid json should fail")
+	}
+}
+
+func TestRegistry_LeaseTTL(t *testing.T) {
+	cases := map[time.Duration]int64{
+		0:                       1,
+		500 * time.Millisecond:  1,
+		time.Second:             1,
+		1500 * time.Millisecond: 2,
+		10 * time.Second:        10,
+	}
+	for ttl, want := range cases {
+		r := New(nil, WithTTL(ttl))
+		if got := r.leaseTTL(); got != want {
+			t.Fatalf("lease ttl for %s = %d, want %d", ttl, got, want)
+		}
+	}
+}
+
+func TestResolver_Apply(t *testing.T) {
+	res := New(nil).Resolver("user")
+	put := func(id, addr string) config.Event {
+		b, _ := json.Marshal(Instance{ID: id, Name: "user", Addr: addr})
+		return config.Event{Type: config.EventPut, Key: "/services/user/" + id, Value: string(b)}
+	}
+
+	var notified []Instance
+	res.OnChange(func(list []Instance) {
+		notified = list
+	})
+	res.apply([]config.Event{put("b", "10.0.0.2:80"), put("a", "10.0.0.1:80"), {Type: config.EventPut, Key: "/services/user/c", Value: "bad"}})
+	list := res.Instances()
+	if len(list) != 2 || list[0].ID != "a" || list[1].ID != "b" || len(notified) != 2 {
+		t.Fatalf("instances = %+v", list)
+	}
+
+	// 轮询
+	first, _ := res.Next()
+	second, _ := res.Next()
+	third, _ := res.Next()
+	if first.ID != "a" || second.ID != "b" || third.ID != "a" {
+		t.Fatalf("next = %s %s %s", first.ID, second.ID, third.ID)
+	}
+
+	res.apply([]config.Event{{Type: config.EventDelete, Key: "/services/user/a"}, put("b", "10.0.0.3:80")})
+	list = res.Instances()
+	if len(list) != 1 || list[0].Addr != "10.0.0.3:80" {
+		t.Fatalf("instances after delete = %+v", list)
+	}
+	res.apply([]config.Event{{Type: config.EventDelete, Key: "/services/user/b"}})
+	if _, ok := res.Next(); ok {
+		t.Fatal("next without instances should return false")
+	}
+}
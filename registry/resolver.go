@@ -0,0 +1,126 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudneedle/gokit/config"
+)
+
+// Resolver 服务发现,监听服务的实例变化并在本地维护实例列表
+//
+// example:
+//
+//	res := reg.Resolver("user")
+//	go res.Watch(ctx)
+//	ins, ok := res.Next()
+type Resolver struct {
+	r    *Registry
+	name string
+
+	mu        sync.RWMutex
+	instances map[string]Instance // key -> 实例
+	list      []Instance          // 按ID排序的实例列表
+	onChange  []func([]Instance)
+	next      uint64
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+// Resolver 创建服务发现
+func (r *Registry) Resolver(name string) *Resolver {
+	return &Resolver{
+		r:         r,
+		name:      name,
+		instances: make(map[string]Instance),
+		ready:     make(chan struct{}),
+	}
+}
+
+// Watch 加载当前实例并监听变化,阻塞直到ctx取消或客户端关闭
+func (res *Resolver) Watch(ctx context.Context) error {
+	prefix := res.r.servicePrefix(res.name)
+	list, rev, err := res.r.instances(ctx, res.name)
+	if err != nil {
+		return err
+	}
+	res.mu.Lock()
+	for _, ins := range list {
+		res.instances[prefix+ins.ID] = ins
+	}
+	res.mu.Unlock()
+	res.update()
+	res.readyOnce.Do(func() { close(res.ready) })
+
+	// 从读取时的版本之后开始监听,不丢失两次调用之间的变化
+	return res.r.etcd.WatchPrefixFrom(ctx, prefix, rev, res.apply)
+}
+
+// apply 应用实例变化事件
+func (res *Resolver) apply(evs []config.Event) {
+	res.mu.Lock()
+	for _, ev := range evs {
+		if ev.Type == config.EventDelete {
+			delete(res.instances, ev.Key)
+			continue
+		}
+		ins, err := decodeInstance([]byte(ev.Value))
+		if err != nil {
+			continue
+		}
+		res.instances[ev.Key] = ins
+	}
+	res.mu.Unlock()
+	res.update()
+}
+
+// update 重建实例列表并通知订阅者
+func (res *Resolver) update() {
+	res.mu.Lock()
+	list := make([]Instance, 0, len(res.instances))
+	for _, ins := range res.instances {
+		list = append(list, ins)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.Compare(list[i].ID, list[j].ID) < 0
+	})
+	res.list = list
+	hooks := res.onChange
+	res.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn(list)
+	}
+}
+
+// Ready 首次加载实例完成后关闭
+func (res *Resolver) Ready() <-chan struct{} {
+	return res.ready
+}
+
+// OnChange 注册实例变化回调
+func (res *Resolver) OnChange(fn func(instances []Instance)) {
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	res.onChange = append(res.onChange, fn)
+}
+
+// Instances 当前的实例列表,不要修改返回值
+func (res *Resolver) Instances() []Instance {
+	res.mu.RLock()
+	defer res.mu.RUnlock()
+	return res.list
+}
+
+// Next 轮询选择一个实例,没有实例时返回false
+func (res *Resolver) Next() (Instance, bool) {
+	list := res.Instances()
+	if len(list) == 0 {
+		return Instance{}, false
+	}
+	n := atomic.AddUint64(&res.next, 1)
+	return list[(n-1)%uint64(len(list))], true
+}
@@ -104,7 +104,7 @@ func (b *biz) GetData() any {
 
 type std struct {
 	status int `json:"-"`
-	data   any `json:"data,omitempty"`
+	data   any
 }
 
 func (s *std) Status() int {
@@ -322,3 +322,21 @@ func (c *Context) Forbidden() ICustomResp {
 		Msg:    "禁止访问",
 	}
 }
+
+// TooManyRequests 请求过于频繁
+//
+// http status: 429
+//
+// example:
+//
+//	{
+//	  "code": 429,
+//	  "msg": "请求过于频繁"
+//	}
+func (c *Context) TooManyRequests() ICustomResp {
+	return &biz{
+		status: 429,
+		Code:   429,
+		Msg:    "请求过于频繁",
+	}
+}
@@ -0,0 +1,296 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudneedle/gokit/config"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	defaultCorsMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+	defaultCorsHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "Token", "AccessToken", "X-CSRF-Token", IdempotencyHeader}
+)
+
+// CorsConfig 跨域配置,可通过config绑定
+//
+// AllowOrigins 支持以下写法:
+//
+//	"*"                      任意来源
+//	https://example.com      完全匹配
+//	https://*.example.com    任意子域名
+//
+// example:
+//
+//	cors:
+//	  allow_origins: https://admin.example.com,https://*.example.com
+//	  allow_credentials: true
+//	  max_age: 1h
+//	  routes:
+//	    - path: /public/
+//	      allow_origins: "*"
+type CorsConfig struct {
+	Disabled            bool                     `config:"disabled"`              // 不处理跨域
+	AllowOrigins        []string                 `config:"allow_origins"`         // 允许的来源
+	AllowOriginPatterns []string                 `config:"allow_origin_patterns"` // 允许的来源正则,需完整匹配
+	AllowOriginFunc     func(origin string) bool `config:"-"`                     // 自定义来源判断,优先于其他规则
+	AllowMethods        []string                 `config:"allow_methods"`         // 为空时使用默认的方法列表
+	AllowHeaders        []string                 `config:"allow_headers"`         // 为空时使用默认的请求头列表,* 表示允许预检请求的所有请求头
+	ExposeHeaders       []string                 `config:"expose_headers"`
+	AllowCredentials    bool                     `config:"allow_credentials"` // 允许携带cookie,不能与任意来源同时使用
+	MaxAge              time.Duration            `config:"max_age"`           // 预检结果的缓存时间,0表示不发送
+	Routes              []CorsRoute              `config:"routes"`            // 按路径前缀覆盖的配置
+}
+
+// CorsRoute 按路径前缀覆盖的跨域配置,最长的前缀优先
+//
+// 未设置的字段继承根配置,其中来源相关的字段作为整体继承;Disabled与AllowCredentials不继承
+type CorsRoute struct {
+	Path string `config:"path" validate:"required"`
+	CorsConfig
+}
+
+// DefaultCorsConfig 默认的跨域配置,允许任意来源但不允许携带cookie
+func DefaultCorsConfig() CorsConfig {
+	return CorsConfig{
+		AllowOrigins:  []string{"*"},
+		ExposeHeaders: []string{"Content-Length", "Content-Type"},
+	}
+}
+
+// CorsFromConfig 从配置读取跨域配置,如 prefix 为 web/cors
+func CorsFromConfig(cli *config.Client, prefix string) (CorsConfig, error) {
+	var cfg CorsConfig
+	err := cli.Unmarshal(prefix, &cfg)
+	return cfg, err
+}
+
+// WithCors 设置跨域配置,未设置时使用DefaultCorsConfig,Disabled为true时不处理跨域
+func WithCors(cfg CorsConfig) ServerOption {
+	return func(s *Server) {
+		s.cors = &cfg
+	}
+}
+
+// Cors 使用默认配置的跨域中间件
+func Cors() gin.HandlerFunc {
+	h, _ := NewCors(DefaultCorsConfig())
+	return h
+}
+
+// NewCors 创建跨域中间件,来源正则无效或同时允许任意来源与携带cookie时返回错误
+func NewCors(cfg CorsConfig) (gin.HandlerFunc, error) {
+	root, err := newCorsPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]corsRoute, 0, len(cfg.Routes))
+	for _, r := range cfg.Routes {
+		p, err := newCorsPolicy(r.inherit(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("web: cors route %s: %w", r.Path, err)
+		}
+		routes = append(routes, corsRoute{prefix: r.Path, policy: p})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return len(routes[i].prefix) > len(routes[j].prefix)
+	})
+
+	return func(c *gin.Context) {
+		p := root
+		for _, r := range routes {
+			if strings.HasPrefix(c.Request.URL.Path, r.prefix) {
+				p = r.policy
+				break
+			}
+		}
+		p.handle(c)
+	}, nil
+}
+
+// inherit 用根配置补全未设置的字段
+func (r CorsRoute) inherit(root CorsConfig) CorsConfig {
+	cfg := r.CorsConfig
+	if len(cfg.AllowOrigins) == 0 && len(cfg.AllowOriginPatterns) == 0 && cfg.AllowOriginFunc == nil {
+		cfg.AllowOrigins = root.AllowOrigins
+		cfg.AllowOriginPatterns = root.AllowOriginPatterns
+		cfg.AllowOriginFunc = root.AllowOriginFunc
+	}
+	if len(cfg.AllowMethods) == 0 {
+		cfg.AllowMethods = root.AllowMethods
+	}
+	if len(cfg.AllowHeaders) == 0 {
+		cfg.AllowHeaders = root.AllowHeaders
+	}
+	if len(cfg.ExposeHeaders) == 0 {
+		cfg.ExposeHeaders = root.ExposeHeaders
+	}
+	if cfg.MaxAge == 0 {
+		cfg.MaxAge = root.MaxAge
+	}
+	return cfg
+}
+
+type corsRoute struct {
+	prefix string
+	policy *corsPolicy
+}
+
+// corsPolicy 预处理后的跨域配置
+type corsPolicy struct {
+	disabled    bool
+	allowAll    bool
+	exact       map[string]bool
+	wildcards   [][2]string // 通配符前后两部分
+	patterns    []*regexp.Regexp
+	fn          func(origin string) bool
+	methods     string
+	headers     string
+	anyHeader   bool
+	expose      string
+	credentials bool
+	maxAge      string
+}
+
+func newCorsPolicy(cfg CorsConfig) (*corsPolicy, error) {
+	p := &corsPolicy{
+		disabled:    cfg.Disabled,
+		exact:       make(map[string]bool),
+		fn:          cfg.AllowOriginFunc,
+		credentials: cfg.AllowCredentials,
+		expose:      strings.Join(cfg.ExposeHeaders, ", "),
+	}
+	for _, o := range cfg.AllowOrigins {
+		o = strings.ToLower(strings.TrimSpace(o))
+		switch {
+		case o == "*":
+			p.allowAll = true
+		case strings.Contains(o, "*"):
+			before, after, _ := strings.Cut(o, "*")
+			p.wildcards = append(p.wildcards, [2]string{before, after})
+		case o != "":
+			p.exact[o] = true
+		}
+	}
+	if p.allowAll && p.credentials {
+		return nil, errors.New("web: cors allow_origins * cannot be used with allow_credentials")
+	}
+	for _, s := range cfg.AllowOriginPatterns {
+		// 完整匹配来源,避免 https://example\.com 匹配到 https://example.com.evil.com
+		re, err := regexp.Compile("^(?:" + s + ")$")
+		if err != nil {
+			return nil, err
+		}
+		p.patterns = append(p.patterns, re)
+	}
+
+	methods := cfg.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCorsMethods
+	}
+	p.methods = strings.ToUpper(strings.Join(methods, ", "))
+	headers := cfg.AllowHeaders
+	if len(headers) == 0 {
+		headers = defaultCorsHeaders
+	}
+	for _, h := range headers {
+		if h == "*" {
+			p.anyHeader = true
+		}
+	}
+	p.headers = strings.Join(headers, ", ")
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge / time.Second))
+	}
+	return p, nil
+}
+
+// allowed 来源是否允许
+func (p *corsPolicy) allowed(origin string) bool {
+	if p.fn != nil {
+		return p.fn(origin)
+	}
+	if p.allowAll {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if p.exact[lower] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+			return true
+		}
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) handle(c *gin.Context) {
+	if p.disabled {
+		c.Next()
+		return
+	}
+	origin := c.GetHeader("Origin")
+	preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+	h := c.Writer.Header()
+	// 响应因来源而异,缓存需要区分来源
+	h.Add("Vary", "Origin")
+	if preflight {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+	}
+	if origin == "" {
+		c.Next()
+		return
+	}
+	if !p.allowed(origin) {
+		if preflight {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		// 不返回跨域头,由浏览器拦截响应
+		c.Next()
+		return
+	}
+
+	if p.allowAll && p.fn == nil && !p.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if preflight {
+		h.Set("Access-Control-Allow-Methods", p.methods)
+		if p.anyHeader {
+			if req := c.GetHeader("Access-Control-Request-Headers"); req != "" {
+				h.Set("Access-Control-Allow-Headers", req)
+			}
+		} else {
+			h.Set("Access-Control-Allow-Headers", p.headers)
+		}
+		if p.maxAge != "" {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	if p.expose != "" {
+		h.Set("Access-Control-Expose-Headers", p.expose)
+	}
+	c.Next()
+}
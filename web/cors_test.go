@@ -0,0 +1,90 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudneedle/gokit/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCors(t *testing.T) {
+	cli, err := config.New(config.WithProvider(config.NewMemory(map[string]string{
+		"cors/allow_origins":          "https://admin.example.com,https://*.example.org",
+		"cors/allow_origin_patterns":  `https://app\.example\.net`,
+		"cors/allow_credentials":      "true",
+		"cors/max_age":                "1h",
+		"cors/routes/0/path":          "/public/",
+		"cors/routes/0/allow_origins": "*",
+		"cors/routes/1/path":          "/admin/",
+		"cors/routes/1/allow_methods": "GET",
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := CorsFromConfig(cli, "cors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxAge != time.Hour || len(cfg.Routes) != 2 {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+
+	h, err := NewCors(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(h)
+	r.GET("/api", func(c *gin.Context) { c.String(200, "ok") })
+	r.GET("/public/a", func(c *gin.Context) { c.String(200, "ok") })
+	r.GET("/admin/a", func(c *gin.Context) { c.String(200, "ok") })
+
+	tests := []struct {
+		method, path, origin string
+		status               int
+		allow                string
+	}{
+		{"GET", "/api", "https://admin.example.com", 200, "https://admin.example.com"},
+		{"GET", "/api", "https://a.b.example.org", 200, "https://a.b.example.org"},
+		{"GET", "/api", "https://evil.com", 200, ""},
+		{"OPTIONS", "/api", "https://evil.com", 403, ""},
+		{"OPTIONS", "/api", "https://admin.example.com", 204, "https://admin.example.com"},
+		{"GET", "/public/a", "https://evil.com", 200, "*"},
+		{"GET", "/api", "https://app.example.net", 200, "https://app.example.net"},
+		// 正则需完整匹配
+		{"GET", "/api", "https://app.example.net.evil.com", 200, ""},
+		{"GET", "/api", "https://evil.com/https://app.example.net", 200, ""},
+		// 路由未设置的来源与max_age继承根配置
+		{"OPTIONS", "/admin/a", "https://admin.example.com", 204, "https://admin.example.com"},
+		{"OPTIONS", "/admin/a", "https://evil.com", 403, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Origin", tt.origin)
+		if tt.method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status || w.Header().Get("Access-Control-Allow-Origin") != tt.allow {
+			t.Fatalf("%s %s from %s: status %d, allow %q", tt.method, tt.path, tt.origin, w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+		}
+		if tt.status == 204 && w.Header().Get("Access-Control-Max-Age") != "3600" {
+			t.Fatalf("max age = %q", w.Header().Get("Access-Control-Max-Age"))
+		}
+		if tt.status == 204 && tt.path == "/admin/a" && w.Header().Get("Access-Control-Allow-Methods") != "GET" {
+			t.Fatalf("admin methods = %q", w.Header().Get("Access-Control-Allow-Methods"))
+		}
+	}
+
+	// 任意来源不能携带cookie
+	if _, err = NewCors(CorsConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}); err == nil {
+		t.Fatal("* with credentials should fail")
+	}
+	if _, err = NewCors(CorsConfig{Routes: []CorsRoute{{Path: "/a", CorsConfig: CorsConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}}}}); err == nil {
+		t.Fatal("route * with credentials should fail")
+	}
+}
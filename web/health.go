@@ -0,0 +1,261 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudneedle/gokit/config"
+	"github.com/cloudneedle/gokit/redis"
+	"github.com/gin-gonic/gin"
+)
+
+// HealthChecker 健康检查
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type checkFunc struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (c checkFunc) Name() string {
+	return c.name
+}
+
+func (c checkFunc) Check(ctx context.Context) error {
+	return c.fn(ctx)
+}
+
+// CheckFunc 使用函数作为健康检查
+func CheckFunc(name string, fn func(ctx context.Context) error) HealthChecker {
+	return checkFunc{name: name, fn: fn}
+}
+
+// RedisChecker 通过PING检查Redis
+func RedisChecker(c *redis.Client) HealthChecker {
+	return CheckFunc("redis", func(ctx context.Context) error {
+		return c.Ping(ctx).Err()
+	})
+}
+
+// EtcdChecker 检查ETCD集群状态
+func EtcdChecker(e *config.Etcd) HealthChecker {
+	return CheckFunc("etcd", e.Status)
+}
+
+type healthOptions struct {
+	checkers   []HealthChecker
+	timeout    time.Duration
+	cacheTTL   time.Duration
+	healthPath string
+	readyPath  string
+	livePath   string
+}
+
+// HealthOption 健康检查选项
+type HealthOption func(*healthOptions)
+
+// WithHealthCheck 添加健康检查
+func WithHealthCheck(checkers ...HealthChecker) HealthOption {
+	return func(o *healthOptions) {
+		o.checkers = append(o.checkers, checkers...)
+	}
+}
+
+// WithHealthTimeout 设置单个检查的超时时间,默认2秒
+func WithHealthTimeout(d time.Duration) HealthOption {
+	return func(o *healthOptions) {
+		o.timeout = d
+	}
+}
+
+// WithHealthCacheTTL 设置检查结果的缓存时间,避免频繁探测压垮依赖,默认1秒
+func WithHealthCacheTTL(d time.Duration) HealthOption {
+	return func(o *healthOptions) {
+		o.cacheTTL = d
+	}
+}
+
+// WithHealthPaths 设置健康、就绪与存活检查的路径,默认 /healthz、/readyz、/livez
+func WithHealthPaths(health, ready, live string) HealthOption {
+	return func(o *healthOptions) {
+		o.healthPath, o.readyPath, o.livePath = health, ready, live
+	}
+}
+
+// WithHealth 注册健康检查路由,不经过认证中间件
+//
+//	/livez    进程存活即返回200,不执行检查
+//	/healthz  执行所有检查,全部通过返回200,否则返回503
+//	/readyz   在/healthz的基础上,未启动或关闭过程中返回503
+//
+// example:
+//
+//	web.WithHealth(web.WithHealthCheck(web.RedisChecker(rdb), web.EtcdChecker(cli.Etcd)))
+//
+// 返回:
+//
+//	{
+//	  "status": "fail",
+//	  "checks": {
+//	    "redis": {"status": "ok", "duration": "1.2ms"},
+//	    "etcd": {"status": "fail", "duration": "2s", "error": "context deadline exceeded"}
+//	  }
+//	}
+func WithHealth(opts ...HealthOption) ServerOption {
+	return func(s *Server) {
+		o := healthOptions{
+			timeout:    2 * time.Second,
+			cacheTTL:   time.Second,
+			healthPath: "/healthz",
+			readyPath:  "/readyz",
+			livePath:   "/livez",
+		}
+		for _, opt := range opts {
+			opt(&o)
+		}
+		s.health = &health{opts: o}
+	}
+}
+
+// CheckResult 单个检查的结果
+type CheckResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthReport 检查结果汇总
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+// health 执行并缓存健康检查
+type health struct {
+	opts healthOptions
+
+	mu       sync.Mutex
+	report   HealthReport
+	expireAt time.Time
+	running  chan struct{} // 正在执行的检查,完成时关闭
+}
+
+// check 返回缓存的结果,过期后执行所有检查,同时到来的请求共用一次检查
+//
+// 检查不使用请求的ctx,避免客户端断开导致缓存失败的结果;ctx只用于结束等待
+func (h *health) check(ctx context.Context) HealthReport {
+	h.mu.Lock()
+	if time.Now().Before(h.expireAt) {
+		report := h.report
+		h.mu.Unlock()
+		return report
+	}
+	if h.running == nil {
+		h.running = make(chan struct{})
+		go h.run(h.running)
+	}
+	running := h.running
+	h.mu.Unlock()
+
+	select {
+	case <-running:
+	case <-ctx.Done():
+		return HealthReport{Status: statusFail, Error: ctx.Err().Error()}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.report
+}
+
+// run 并发执行所有检查并缓存结果,完成后关闭done
+func (h *health) run(done chan struct{}) {
+	report := HealthReport{Status: statusOK, Checks: make(map[string]CheckResult, len(h.opts.checkers))}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for _, c := range h.opts.checkers {
+		c := c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := h.checkOne(c)
+			res := CheckResult{Status: statusOK, Duration: time.Since(start).String()}
+			if err != nil {
+				res.Status, res.Error = statusFail, err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.Name()] = res
+			if err != nil {
+				report.Status = statusFail
+			}
+		}()
+	}
+	wg.Wait()
+
+	h.mu.Lock()
+	h.report, h.expireAt = report, time.Now().Add(h.opts.cacheTTL)
+	h.running = nil
+	h.mu.Unlock()
+	close(done)
+}
+
+// checkOne 执行单个检查,检查不响应ctx时超时也按失败返回
+func (h *health) checkOne(c HealthChecker) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.opts.timeout)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Check(ctx)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// routes 注册健康检查路由
+func (h *health) routes(r *gin.Engine, s *Server) {
+	r.GET(h.opts.livePath, func(c *gin.Context) {
+		c.JSON(http.StatusOK, HealthReport{Status: statusOK})
+	})
+	r.GET(h.opts.healthPath, func(c *gin.Context) {
+		report := h.check(c.Request.Context())
+		c.JSON(reportStatus(report), report)
+	})
+	r.GET(h.opts.readyPath, func(c *gin.Context) {
+		// 未启动或正在关闭时不执行检查
+		if s.Draining() {
+			c.JSON(http.StatusServiceUnavailable, HealthReport{Status: statusFail, Error: "shutting down"})
+			return
+		}
+		if !s.Ready() {
+			c.JSON(http.StatusServiceUnavailable, HealthReport{Status: statusFail, Error: "not started"})
+			return
+		}
+		report := h.check(c.Request.Context())
+		c.JSON(reportStatus(report), report)
+	})
+}
+
+func reportStatus(report HealthReport) int {
+	if report.Status != statusOK {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
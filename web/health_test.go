@@ -0,0 +1,135 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+	srv, err := NewServer(WithHealth(WithHealthCheck(
+		CheckFunc("ok", func(ctx context.Context) error { return nil }),
+		CheckFunc("flaky", func(ctx context.Context) error {
+			calls.Add(1)
+			if fail.Load() {
+				return errors.New("down")
+			}
+			return nil
+		}),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) (int, HealthReport) {
+		w := httptest.NewRecorder()
+		srv.GIN().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var report HealthReport
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, report
+	}
+
+	if code, _ := get("/livez"); code != http.StatusOK {
+		t.Fatalf("livez = %d", code)
+	}
+	if code, report := get("/readyz"); code != http.StatusServiceUnavailable || report.Error != "not started" {
+		t.Fatalf("readyz before start = %d %+v", code, report)
+	}
+	code, report := get("/healthz")
+	if code != http.StatusOK || len(report.Checks) != 2 {
+		t.Fatalf("healthz = %d %+v", code, report)
+	}
+
+	// 结果被缓存,不会再次执行检查
+	fail.Store(true)
+	if code, _ = get("/healthz"); code != http.StatusOK || calls.Load() != 1 {
+		t.Fatalf("healthz cached = %d, calls = %d", code, calls.Load())
+	}
+
+	srv.health.expireAt = srv.health.expireAt.AddDate(-1, 0, 0)
+	code, report = get("/healthz")
+	if code != http.StatusServiceUnavailable || report.Checks["flaky"].Error != "down" || report.Checks["ok"].Status != statusOK {
+		t.Fatalf("healthz failing = %d %+v", code, report)
+	}
+}
+
+func TestHealth_Ready(t *testing.T) {
+	srv, err := NewServer(WithDrainPeriod(200*time.Millisecond), WithHealth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() (int, string) {
+		resp, err := http.Get("http://127.0.0.1" + srv.Host() + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var report HealthReport
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, report.Error
+	}
+
+	if err = srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := get(); code != http.StatusOK {
+		t.Fatalf("readyz after start = %d", code)
+	}
+
+	// drain期间仍处理请求,但不再就绪
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Shutdown(context.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if code, msg := get(); code != http.StatusServiceUnavailable || msg != "shutting down" {
+		t.Fatalf("readyz while draining = %d %q", code, msg)
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHealth_SlowCheck(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	srv, err := NewServer(WithHealth(WithHealthTimeout(50*time.Millisecond), WithHealthCheck(
+		// 不响应ctx的检查
+		CheckFunc("stuck", func(ctx context.Context) error {
+			<-block
+			return nil
+		}),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 检查进行中时,其他请求随自己的ctx结束等待
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if report := srv.health.check(ctx); report.Status != statusFail || time.Since(start) > 40*time.Millisecond {
+		t.Fatalf("check with cancelled ctx = %+v after %v", report, time.Since(start))
+	}
+
+	w := httptest.NewRecorder()
+	srv.GIN().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var report HealthReport
+	if err = json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusServiceUnavailable || report.Checks["stuck"].Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("healthz = %d %+v", w.Code, report)
+	}
+}
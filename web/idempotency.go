@@ -0,0 +1,302 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudneedle/gokit/redis"
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyHeader 幂等键请求头
+const IdempotencyHeader = "Idempotency-Key"
+
+const (
+	idempotencyProcessing = "processing"
+	idempotencyDone       = "done"
+)
+
+// idempotencyRecord 保存在Redis中的请求记录
+type idempotencyRecord struct {
+	State  string      `json:"state"`
+	Hash   string      `json:"hash"`
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+type idempotencyOptions struct {
+	prefix   string
+	ttl      time.Duration
+	lockTTL  time.Duration
+	scope    KeyFunc
+	required bool
+	maxBody  int64
+}
+
+// IdempotencyOption 幂等中间件选项
+type IdempotencyOption func(*idempotencyOptions)
+
+// WithIdempotencyPrefix 设置Redis key前缀,默认 idempotency:
+func WithIdempotencyPrefix(prefix string) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithIdempotencyTTL 设置响应的保存时间,默认24小时
+func WithIdempotencyTTL(ttl time.Duration) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithIdempotencyLockTTL 设置处理中标记的过期时间,应大于请求的最长处理时间,默认1分钟
+func WithIdempotencyLockTTL(ttl time.Duration) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.lockTTL = ttl
+	}
+}
+
+// WithIdempotencyScope 设置幂等键的作用域,如 KeyByJWTSubject,不同用户使用相同的幂等键互不影响
+func WithIdempotencyScope(fn KeyFunc) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.scope = fn
+	}
+}
+
+// WithIdempotencyRequired 设置是否必须携带幂等键,默认否,未携带时按普通请求处理
+func WithIdempotencyRequired(required bool) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.required = required
+	}
+}
+
+// WithIdempotencyMaxBody 设置参与摘要计算的请求体上限,超出时返回413,默认1MB
+func WithIdempotencyMaxBody(n int64) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.maxBody = n
+	}
+}
+
+// responseRecorder 在写出响应的同时记录响应体
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency 幂等中间件,按 Idempotency-Key 请求头保存首次请求的响应
+//
+//   - 重复请求直接返回保存的响应,并带有 Idempotent-Replayed: true 响应头
+//   - 首次请求仍在处理中时返回409
+//   - 相同的幂等键但请求体不同时返回422
+//   - 首次请求返回5xx或panic时不保存,允许客户端重试
+//
+// example:
+//
+//	ctx.POST("/orders", web.Idempotency(cli, web.WithIdempotencyScope(web.KeyByJWTSubject(j))), ctx.Handle(createOrder))
+func Idempotency(cli *redis.Client, opts ...IdempotencyOption) gin.HandlerFunc {
+	o := idempotencyOptions{
+		prefix:  "idempotency:",
+		ttl:     24 * time.Hour,
+		lockTTL: time.Minute,
+		maxBody: 1 << 20,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			if o.required {
+				abortBiz(c, &biz{status: 400, Code: 400, Msg: "缺少" + IdempotencyHeader})
+				return
+			}
+			c.Next()
+			return
+		}
+		if o.scope != nil {
+			key = o.scope(c) + ":" + key
+		}
+		key = o.prefix + key
+
+		hash, err := requestHash(c, o.maxBody)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abortBiz(c, &biz{status: 413, Code: 413, Msg: "请求体过大"})
+				return
+			}
+			abortBiz(c, &biz{status: 400, Code: 400, Msg: err.Error()})
+			return
+		}
+
+		ctx := c.Request.Context()
+		lock, _ := json.Marshal(idempotencyRecord{State: idempotencyProcessing, Hash: hash})
+		ok, err := cli.SetNX(ctx, key, lock, o.lockTTL).Result()
+		if err != nil {
+			log.Println("Idempotency:", err)
+			c.Next()
+			return
+		}
+		if !ok {
+			replay(c, cli, key, hash)
+			return
+		}
+
+		// 外层中间件已设置的响应头,保存时排除
+		before := c.Writer.Header().Clone()
+		rec := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		defer func() {
+			if r := recover(); r != nil {
+				// 处理函数panic时删除处理中标记,允许客户端立即重试
+				delCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+				if err := cli.Del(delCtx, key).Err(); err != nil {
+					log.Println("Idempotency:", err)
+				}
+				cancel()
+				panic(r)
+			}
+		}()
+		c.Next()
+
+		// 请求已结束,使用新的ctx保存结果
+		saveCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		status := rec.Status()
+		if status >= http.StatusInternalServerError {
+			err = cli.Del(saveCtx, key).Err()
+		} else {
+			header := handlerHeader(before, rec.Header())
+			done, _ := json.Marshal(idempotencyRecord{
+				State:  idempotencyDone,
+				Hash:   hash,
+				Status: status,
+				Header: header,
+				Body:   rec.body.Bytes(),
+			})
+			err = cli.Set(saveCtx, key, done, o.ttl).Err()
+		}
+		if err != nil {
+			log.Println("Idempotency:", err)
+		}
+	}
+}
+
+// Idempotency 创建幂等中间件,用于路由或路由组
+func (r *RouteContext) Idempotency(cli *redis.Client, opts ...IdempotencyOption) gin.HandlerFunc {
+	return Idempotency(cli, opts...)
+}
+
+// replay 处理重复请求
+func replay(c *gin.Context, cli *redis.Client, key, hash string) {
+	b, err := cli.Get(c.Request.Context(), key).Bytes()
+	if err == redis.Nil {
+		// 首次请求刚好结束且未保存结果
+		abortBiz(c, &biz{status: 409, Code: 409, Msg: "请求正在处理中"})
+		return
+	}
+	var record idempotencyRecord
+	if err == nil {
+		err = json.Unmarshal(b, &record)
+	}
+	if err != nil {
+		log.Println("Idempotency:", err)
+		abortBiz(c, &biz{status: 500, Code: 500, Msg: err.Error()})
+		return
+	}
+
+	switch {
+	case record.Hash != hash:
+		abortBiz(c, &biz{status: 422, Code: 422, Msg: "幂等键已用于不同的请求"})
+	case record.State == idempotencyProcessing:
+		abortBiz(c, &biz{status: 409, Code: 409, Msg: "请求正在处理中"})
+	default:
+		// 覆盖而不是追加,外层中间件已为本次请求设置过的头不会重复
+		for k, vs := range record.Header {
+			c.Writer.Header()[k] = append([]string(nil), vs...)
+		}
+		c.Header("Idempotent-Replayed", "true")
+		c.Status(record.Status)
+		_, _ = c.Writer.Write(record.Body)
+		c.Abort()
+	}
+}
+
+// replaySkipHeaders 不保存的响应头,由外层中间件按每次请求设置
+var replaySkipHeaders = map[string]bool{
+	"Date":       true,
+	"Set-Cookie": true,
+	"Vary":       true,
+}
+
+// handlerHeader 处理函数设置的响应头,排除外层中间件设置的跨域、限流与会话相关的头
+func handlerHeader(before, after http.Header) http.Header {
+	header := make(http.Header)
+	for k, vs := range after {
+		if replaySkipHeaders[k] || strings.HasPrefix(k, "Access-Control-") || strings.HasPrefix(k, "Ratelimit-") || k == "Retry-After" {
+			continue
+		}
+		if old, ok := before[k]; ok && equalValues(old, vs) {
+			continue
+		}
+		header[k] = vs
+	}
+	return header
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// requestHash 请求方法、路径与请求体的摘要,读取后重置请求体,请求体超过limit时返回*http.MaxBytesError
+func requestHash(c *gin.Context, limit int64) (string, error) {
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		if body, err = io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit)); err != nil {
+			return "", err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// abortBiz 以biz格式返回并中止后续处理
+func abortBiz(c *gin.Context, resp ICustomResp) {
+	if b, ok := resp.(*biz); ok {
+		setBizCode(c, b.Code)
+	}
+	c.AbortWithStatusJSON(resp.Status(), resp.GetData())
+}
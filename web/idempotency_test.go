@@ -0,0 +1,150 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cloudneedle/gokit/redis"
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotency(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(redis.Options{Addr: mr.Addr()})
+	defer cli.Close()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, err any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	var calls int32
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	r.POST("/orders", Idempotency(cli), func(c *gin.Context) {
+		n := atomic.AddInt32(&calls, 1)
+		switch c.Query("mode") {
+		case "slow":
+			started <- struct{}{}
+			<-release
+		case "panic":
+			panic("boom")
+		}
+		c.Header("X-Order", "1")
+		c.JSON(http.StatusCreated, gin.H{"n": n})
+	})
+
+	do := func(key, query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/orders"+query, strings.NewReader(body))
+		req.Header.Set(IdempotencyHeader, key)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 重复请求返回保存的响应
+	first := do("a", "", `{"sku":1}`)
+	if first.Code != http.StatusCreated || first.Body.String() != `{"n":1}` {
+		t.Fatalf("first = %d %s", first.Code, first.Body.String())
+	}
+	w := do("a", "", `{"sku":1}`)
+	if w.Code != http.StatusCreated || w.Body.String() != `{"n":1}` ||
+		w.Header().Get("Idempotent-Replayed") != "true" || w.Header().Get("X-Order") != "1" {
+		t.Fatalf("replay = %d %s %v", w.Code, w.Body.String(), w.Header())
+	}
+	if calls != 1 {
+		t.Fatalf("handler calls = %d, want 1", calls)
+	}
+
+	// 相同的幂等键用于不同的请求体
+	if w = do("a", "", `{"sku":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("body mismatch = %d %s", w.Code, w.Body.String())
+	}
+
+	// 首次请求处理中时的并发重复请求
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- do("b", "?mode=slow", "")
+	}()
+	<-started
+	if w = do("b", "?mode=slow", ""); w.Code != http.StatusConflict {
+		t.Fatalf("concurrent duplicate = %d %s", w.Code, w.Body.String())
+	}
+	close(release)
+	if w = <-done; w.Code != http.StatusCreated {
+		t.Fatalf("slow request = %d", w.Code)
+	}
+
+	// panic后删除处理中标记,可以立即重试
+	if w = do("c", "?mode=panic", ""); w.Code != http.StatusInternalServerError {
+		t.Fatalf("panic = %d", w.Code)
+	}
+	if mr.Exists("idempotency:c") {
+		t.Fatal("processing record left after panic")
+	}
+	if w = do("c", "", ""); w.Code != http.StatusCreated {
+		t.Fatalf("retry after panic = %d %s", w.Code, w.Body.String())
+	}
+}
+
+type idempotencyRoutes struct {
+	cli *redis.Client
+}
+
+func (r idempotencyRoutes) Routes(ctx *RouteContext) {
+	ctx.POST("/orders", ctx.Idempotency(r.cli, WithIdempotencyMaxBody(16)), func(c *gin.Context) {
+		c.Header("Location", "/orders/1")
+		c.SetCookie("order", "1", 60, "/", "", false, true)
+		c.JSON(http.StatusCreated, gin.H{"id": 1})
+	})
+}
+
+func TestIdempotency_ReplayWithCors(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(redis.Options{Addr: mr.Addr()})
+	defer cli.Close()
+	srv, err := NewServer(
+		WithCors(CorsConfig{AllowOrigins: []string{"https://a.example.com"}, AllowCredentials: true}),
+		WithRoutes(idempotencyRoutes{cli: cli}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		req.Header.Set(IdempotencyHeader, "a")
+		req.Header.Set("Origin", "https://a.example.com")
+		srv.GIN().ServeHTTP(w, req)
+		return w
+	}
+
+	first := do("{}")
+	if first.Code != http.StatusCreated || len(first.Result().Cookies()) != 1 {
+		t.Fatalf("first = %d %v", first.Code, first.Header())
+	}
+	w := do("{}")
+	if w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" || w.Body.String() != first.Body.String() {
+		t.Fatalf("replay = %d %s %v", w.Code, w.Body.String(), w.Header())
+	}
+	h := w.Header()
+	for _, k := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Vary", "Content-Type", "Location"} {
+		if len(h.Values(k)) != 1 {
+			t.Fatalf("replayed %s = %v", k, h.Values(k))
+		}
+	}
+	if h.Get("Location") != "/orders/1" {
+		t.Fatalf("replayed location = %q", h.Get("Location"))
+	}
+	// 其他请求的cookie不会被重放
+	if len(w.Result().Cookies()) != 0 {
+		t.Fatalf("replayed cookies = %v", w.Result().Cookies())
+	}
+
+	if w = do(strings.Repeat("x", 17)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large body = %d", w.Code)
+	}
+}
@@ -0,0 +1,194 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// bizCodeKey gin.Context中保存业务code的key
+const bizCodeKey = "gokit/web:biz_code"
+
+// unmatchedRoute 未匹配到路由时的route标签,避免原始路径导致标签数量无限增长
+const unmatchedRoute = "unmatched"
+
+// otherMethod 非标准方法的method标签,避免任意方法名导致标签数量无限增长
+const otherMethod = "OTHER"
+
+// metricMethod 标准方法原样返回,其他方法返回otherMethod
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return otherMethod
+}
+
+// setBizCode 记录响应的业务code,供指标使用
+func setBizCode(c *gin.Context, code int) {
+	c.Set(bizCodeKey, code)
+}
+
+type metricsOptions struct {
+	namespace string
+	buckets   []float64
+	registry  *prometheus.Registry
+	path      string
+	addr      string
+}
+
+// MetricsOption 指标选项
+type MetricsOption func(*metricsOptions)
+
+// WithMetricsNamespace 设置指标名称的前缀,默认无
+func WithMetricsNamespace(ns string) MetricsOption {
+	return func(o *metricsOptions) {
+		o.namespace = ns
+	}
+}
+
+// WithMetricsBuckets 设置请求耗时直方图的桶,单位秒,默认 prometheus.DefBuckets
+func WithMetricsBuckets(buckets ...float64) MetricsOption {
+	return func(o *metricsOptions) {
+		o.buckets = buckets
+	}
+}
+
+// WithMetricsRegistry 使用已有的registry,默认创建新的registry并注册Go运行时与进程指标
+func WithMetricsRegistry(reg *prometheus.Registry) MetricsOption {
+	return func(o *metricsOptions) {
+		o.registry = reg
+	}
+}
+
+// WithMetricsPath 设置指标的路径,默认 /metrics
+func WithMetricsPath(path string) MetricsOption {
+	return func(o *metricsOptions) {
+		o.path = path
+	}
+}
+
+// WithMetricsAddr 在单独的管理端口上提供指标,如 :9100,不设置时与业务路由共用端口
+func WithMetricsAddr(addr string) MetricsOption {
+	return func(o *metricsOptions) {
+		o.addr = addr
+	}
+}
+
+// Metrics HTTP请求指标
+//
+// 记录请求数、耗时与处理中的请求数,标签为路由模板、方法、HTTP状态码与业务code
+//
+// example:
+//
+//	m, err := web.NewMetrics(web.WithMetricsAddr(":9100"))
+//	m.Registry().MustRegister(redis.NewPoolCollector(rdb, "cache"))
+//	cli, err := config.New(config.WithPath(addr), config.WithEtcdMetrics(m.Registry()))
+//	srv, err := web.NewServer(web.WithMetrics(m))
+type Metrics struct {
+	opts metricsOptions
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inflight *prometheus.GaugeVec
+}
+
+// NewMetrics 创建指标并注册到registry
+func NewMetrics(opts ...MetricsOption) (*Metrics, error) {
+	o := metricsOptions{
+		buckets: prometheus.DefBuckets,
+		path:    "/metrics",
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.registry == nil {
+		o.registry = prometheus.NewRegistry()
+		o.registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+
+	m := &Metrics{
+		opts: o,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Total number of HTTP requests.",
+		}, []string{"route", "method", "status", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency in seconds.",
+			Buckets:   o.buckets,
+		}, []string{"route", "method", "status", "code"}),
+		inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: o.namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "Number of HTTP requests being served.",
+		}, []string{"route", "method"}),
+	}
+	for _, c := range []prometheus.Collector{m.requests, m.duration, m.inflight} {
+		if err := o.registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Registry 指标的registry,用于注册Redis连接池、ETCD客户端等其他指标
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.opts.registry
+}
+
+// Handler 输出指标的HTTP处理器
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.opts.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware 记录请求指标的中间件,route标签使用路由模板如 /users/:id
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == m.opts.path && m.opts.addr == "" {
+			c.Next()
+			return
+		}
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := metricMethod(c.Request.Method)
+		inflight := m.inflight.WithLabelValues(route, method)
+		inflight.Inc()
+		defer inflight.Dec()
+
+		start := time.Now()
+		c.Next()
+
+		code := ""
+		if v, ok := c.Get(bizCodeKey); ok {
+			code = strconv.Itoa(v.(int))
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		m.requests.WithLabelValues(route, method, status, code).Inc()
+		m.duration.WithLabelValues(route, method, status, code).Observe(time.Since(start).Seconds())
+	}
+}
+
+// WithMetrics 启用请求指标,未设置WithMetricsAddr时在业务端口注册指标路由,
+// 否则Start时在管理端口单独提供指标
+func WithMetrics(m *Metrics) ServerOption {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type metricsRoutes struct{}
+
+func (metricsRoutes) Routes(r *RouteContext) {
+	r.GET("/users/:id", r.Handle(func(ctx *Context) any {
+		return ctx.BizBad(1001, "用户不存在")
+	}))
+}
+
+func TestMetrics(t *testing.T) {
+	m, err := NewMetrics(WithMetricsRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := NewServer(WithMetrics(m), WithRoutes(metricsRoutes{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		w := httptest.NewRecorder()
+		srv.GIN().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if n := testutil.ToFloat64(m.requests.WithLabelValues("/users/:id", "GET", "200", "1001")); n != 2 {
+		t.Fatalf("requests = %v, want 2", n)
+	}
+	if n := testutil.ToFloat64(m.requests.WithLabelValues(unmatchedRoute, "GET", "404", "")); n != 1 {
+		t.Fatalf("unmatched requests = %v, want 1", n)
+	}
+	w := httptest.NewRecorder()
+	srv.GIN().ServeHTTP(w, httptest.NewRequest("FOOBAR", "/users/1", nil))
+	if n := testutil.ToFloat64(m.requests.WithLabelValues(unmatchedRoute, otherMethod, "404", "")); n != 1 {
+		t.Fatalf("other method requests = %v, want 1", n)
+	}
+	if n := testutil.ToFloat64(m.inflight.WithLabelValues("/users/:id", "GET")); n != 0 {
+		t.Fatalf("in flight = %v, want 0", n)
+	}
+
+	w = httptest.NewRecorder()
+	srv.GIN().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `http_request_duration_seconds_count{code="1001",method="GET",route="/users/:id",status="200"} 2`) {
+		t.Fatalf("metrics = %d\n%s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudneedle/gokit/redis"
+	"github.com/cloudneedle/gokit/tools"
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc 从请求中提取限流的key,返回空字符串时不限流
+type KeyFunc func(c *gin.Context) string
+
+// KeyByIP 按客户端IP限流
+func KeyByIP() KeyFunc {
+	return func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// KeyByJWTSubject 按JWT的sub限流,没有token或token无效时按客户端IP限流
+func KeyByJWTSubject(j *tools.JWT) KeyFunc {
+	return KeyByJWTClaim(j, "sub")
+}
+
+// KeyByJWTClaim 按JWT的指定字段限流,如 user_id,没有token或token无效时按客户端IP限流
+func KeyByJWTClaim(j *tools.JWT, claim string) KeyFunc {
+	return func(c *gin.Context) string {
+		token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer"))
+		if token != "" {
+			if claims, err := j.ParseToken(token); err == nil {
+				if v, ok := claims[claim]; ok && v != nil {
+					return "jwt:" + fmt.Sprint(v)
+				}
+			}
+		}
+		return "ip:" + c.ClientIP()
+	}
+}
+
+type rateLimitOptions struct {
+	key   KeyFunc
+	scope string
+}
+
+// RateLimitOption 限流中间件选项
+type RateLimitOption func(*rateLimitOptions)
+
+// WithRateLimitKey 设置限流key的提取方式,默认KeyByIP
+func WithRateLimitKey(fn KeyFunc) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.key = fn
+	}
+}
+
+// WithRateLimitScope 设置限流的作用域,不同作用域分别计数,如 login
+func WithRateLimitScope(scope string) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.scope = scope
+	}
+}
+
+// RateLimit 限流中间件,响应中带有 RateLimit-Limit、RateLimit-Remaining、RateLimit-Reset 头,
+// 超出限制时返回429,限流器出错时放行
+//
+// example:
+//
+//	limiter := redis.NewSlidingWindow(cli, 5, time.Minute)
+//	login := ctx.Group("/login", web.RateLimit(limiter, web.WithRateLimitScope("login")))
+func RateLimit(l redis.Limiter, opts ...RateLimitOption) gin.HandlerFunc {
+	o := rateLimitOptions{key: KeyByIP()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(c *gin.Context) {
+		key := o.key(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if o.scope != "" {
+			key = o.scope + ":" + key
+		}
+		res, err := l.Allow(c.Request.Context(), key)
+		if err != nil {
+			log.Println("RateLimit:", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(seconds(res.ResetAfter)))
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+			abortBiz(c, (&Context{c}).TooManyRequests())
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimit 创建限流中间件,用于路由组
+//
+// example:
+//
+//	api := ctx.Group("/api", ctx.RateLimit(limiter))
+func (r *RouteContext) RateLimit(l redis.Limiter, opts ...RateLimitOption) gin.HandlerFunc {
+	return RateLimit(l, opts...)
+}
+
+// seconds 向上取整的秒数
+func seconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
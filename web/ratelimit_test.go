@@ -0,0 +1,74 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudneedle/gokit/redis"
+	"github.com/cloudneedle/gokit/tools"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/login", RateLimit(redis.NewTokenBucket(nil, 0.5, 2), WithRateLimitScope("login")), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	do := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/login", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for i, remaining := range []string{"1", "0"} {
+		w := do()
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != remaining {
+			t.Fatalf("request #%d = %d %v", i, w.Code, w.Header())
+		}
+	}
+	w := do()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" || w.Header().Get("RateLimit-Reset") != "4" {
+		t.Fatalf("limited = %d %v", w.Code, w.Header())
+	}
+	if body := w.Body.String(); body != `{"code":429,"msg":"请求过于频繁"}` {
+		t.Fatalf("limited body = %s", body)
+	}
+}
+
+func TestRateLimit_Keys(t *testing.T) {
+	j := tools.NewJWT("secret", 60)
+	token, err := j.GenerateToken(map[string]interface{}{"sub": "u1", "user_id": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newCtx := func(auth string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.RemoteAddr = "10.0.0.1:1234"
+		if auth != "" {
+			c.Request.Header.Set("Authorization", auth)
+		}
+		return c
+	}
+	for _, tc := range []struct {
+		key  KeyFunc
+		auth string
+		want string
+	}{
+		{KeyByIP(), "", "ip:10.0.0.1"},
+		{KeyByJWTSubject(j), "Bearer " + token, "jwt:u1"},
+		{KeyByJWTClaim(j, "user_id"), "Bearer " + token, "jwt:7"},
+		{KeyByJWTClaim(j, "tenant"), "Bearer " + token, "ip:10.0.0.1"},
+		{KeyByJWTSubject(j), "Bearer invalid", "ip:10.0.0.1"},
+		{KeyByJWTSubject(j), "", "ip:10.0.0.1"},
+	} {
+		if got := tc.key(newCtx(tc.auth)); got != tc.want {
+			t.Fatalf("key(%q) = %q, want %q", tc.auth, got, tc.want)
+		}
+	}
+}
@@ -5,32 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"github.com/cloudneedle/gokit/errorx"
+	"github.com/cloudneedle/gokit/registry"
+	"github.com/cloudneedle/gokit/tools"
 	"github.com/gin-gonic/gin"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-func Cors() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		method := c.Request.Method
-
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Headers", "Content-Type,AccessToken,X-CSRF-Token, Authorization, Token")
-		c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type")
-		c.Header("Access-Control-Allow-Credentials", "true")
-
-		if method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-		}
-		c.Next()
-	}
-}
-
 type RouteContext struct {
 	*gin.Engine
 	Auth gin.IRoutes
@@ -42,6 +30,9 @@ func (r *RouteContext) Handle(fn func(ctx *Context) any) gin.HandlerFunc {
 		res := fn(ctx)
 		// 判断是否是自定义响应
 		if customResp, ok := res.(ICustomResp); ok {
+			if b, ok := customResp.(*biz); ok {
+				setBizCode(c, b.Code)
+			}
 			c.JSON(customResp.Status(), customResp.GetData())
 			return
 		}
@@ -50,12 +41,16 @@ func (r *RouteContext) Handle(fn func(ctx *Context) any) gin.HandlerFunc {
 			// 判断是否是自定义错误
 			var customErr *errorx.Error
 			if ok := errors.As(err, &customErr); ok {
+				if code := customErr.Code(); code != nil {
+					setBizCode(c, code.Int())
+				}
 				c.JSON(400, gin.H{
 					"code": customErr.Code(),
 					"msg":  customErr.Error(),
 				})
 				return
 			}
+			setBizCode(c, 500)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"code": 500,
 				"msg":  err.Error(),
@@ -76,6 +71,28 @@ type Server struct {
 	routes         []IRoute
 	authMiddleware gin.HandlerFunc
 	g              *gin.Engine
+
+	registry    *registry.Registry // 服务注册,为nil时不注册
+	serviceName string             // 注册的服务名
+	instance    registry.Instance  // 已注册的实例
+
+	onStart   []func(ctx context.Context) error // 启动时按注册的顺序执行
+	onStop    []func(ctx context.Context) error // 关闭时按注册的逆序执行
+	stopMarks []int                             // 注册每个OnStart时已注册的OnStop数量,用于启动失败时回滚
+
+	mu              sync.Mutex
+	srv             *http.Server
+	errc            chan error    // 运行中HTTP服务的错误
+	started         atomic.Bool   // 已启动
+	draining        atomic.Bool   // 正在关闭
+	drain           time.Duration // 关闭前保持未就绪的时间
+	shutdownTimeout time.Duration // 等待请求处理完成的时间
+
+	sessions *SessionManager // 会话管理,为nil时不启用
+	cors     *CorsConfig     // 跨域配置,为nil时使用DefaultCorsConfig
+	health   *health         // 健康检查,为nil时不注册
+	metrics  *Metrics        // 请求指标,为nil时不采集
+	admin    *http.Server    // 单独提供指标的管理端口
 }
 
 // ServerOption Server Option type
@@ -102,10 +119,35 @@ func WithAuthMiddleware(authMiddleware gin.HandlerFunc) ServerOption {
 	}
 }
 
+// WithDrainPeriod 设置关闭前的等待时间,期间Ready返回false但仍正常处理请求,
+// 以便负载均衡在连接关闭前摘除当前实例,默认0
+func WithDrainPeriod(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.drain = d
+	}
+}
+
+// WithShutdownTimeout 设置Run关闭时等待请求处理完成与执行OnStop的时间,不含drain时间,默认5秒
+func WithShutdownTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.shutdownTimeout = d
+	}
+}
+
+// WithRegistry 设置服务注册,Start启动后以name注册当前实例,优雅关闭时注销
+func WithRegistry(r *registry.Registry, name string) ServerOption {
+	return func(s *Server) {
+		s.registry = r
+		s.serviceName = name
+	}
+}
+
 // NewServer 创建一个新的Server,默认debug模式
 func NewServer(opts ...ServerOption) (*Server, error) {
 	s := &Server{
-		isDebug: true,
+		isDebug:         true,
+		errc:            make(chan error, 1),
+		shutdownTimeout: 5 * time.Second,
 	}
 
 	for _, opt := range opts {
@@ -119,19 +161,44 @@ func NewServer(opts ...ServerOption) (*Server, error) {
 	}
 
 	// 设置http server
-	s.setHttpServer()
+	if err = s.setHttpServer(); err != nil {
+		return nil, err
+	}
 
 	return s, nil
 }
 
-func (s *Server) setHttpServer() {
+func (s *Server) setHttpServer() error {
 	if !s.isDebug {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	cors := DefaultCorsConfig()
+	if s.cors != nil {
+		cors = *s.cors
+	}
+	corsHandler, err := NewCors(cors)
+	if err != nil {
+		return err
+	}
+
 	r := gin.New()
-	r.Use(Cors())
+	if s.metrics != nil {
+		// 最先执行,以便统计被其他中间件中止的请求
+		r.Use(s.metrics.Middleware())
+		if s.metrics.opts.addr == "" {
+			r.GET(s.metrics.opts.path, gin.WrapH(s.metrics.Handler()))
+		}
+	}
+	r.Use(corsHandler)
 	r.Use(gin.Recovery())
+	if s.sessions != nil {
+		r.Use(s.sessions.Middleware())
+	}
+
+	if s.health != nil {
+		s.health.routes(r, s)
+	}
 
 	authRoute := r.Group("", s.authMiddleware)
 	// 注册路由
@@ -145,6 +212,7 @@ func (s *Server) setHttpServer() {
 	}
 
 	s.g = r
+	return nil
 }
 
 func (s *Server) GIN() *gin.Engine {
@@ -155,33 +223,251 @@ func (s *Server) Host() string {
 	return s.host
 }
 
-// Run 运行Server
-func (s *Server) Run() {
+// OnStart 注册启动时执行的函数,在开始监听之前按注册的顺序执行,如连接数据库
+func (s *Server) OnStart(fn func(ctx context.Context) error) {
+	s.onStart = append(s.onStart, fn)
+	s.stopMarks = append(s.stopMarks, len(s.onStop))
+}
+
+// OnStop 注册关闭时执行的函数,在HTTP服务关闭后按注册的逆序执行,如停止后台任务、关闭Redis与ETCD
+//
+// OnStop与之前最近注册的OnStart配对,启动失败时只回滚已完成的OnStart对应的OnStop
+func (s *Server) OnStop(fn func(ctx context.Context) error) {
+	s.onStop = append(s.onStop, fn)
+}
+
+// Ready 是否可以接收流量,启动前与关闭过程中返回false
+func (s *Server) Ready() bool {
+	return s.started.Load() && !s.draining.Load()
+}
+
+// Draining 是否正在关闭
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// Start 执行OnStart,开始监听并注册服务,不阻塞
+//
+// 监听失败等错误直接返回;运行中HTTP服务出错时通过Err()返回。
+// 启动失败时关闭已开始的监听,按逆序执行已完成的OnStart对应的OnStop,之后可以重新调用Start
+func (s *Server) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv != nil {
+		return errors.New("web: server already started")
+	}
+
+	var err error
+	n := 0 // 已完成的OnStart数量
+	for _, fn := range s.onStart {
+		if err = fn(ctx); err != nil {
+			break
+		}
+		n++
+	}
+	if err == nil {
+		err = s.serve()
+	}
+	if err == nil {
+		err = s.startAdmin()
+	}
+	if err == nil {
+		// 注册服务
+		err = s.register(ctx)
+	}
+	if err != nil {
+		s.abortStart(n)
+		return err
+	}
+	s.started.Store(true)
+	return nil
+}
+
+// serve 开始监听并处理请求
+func (s *Server) serve() error {
+	ln, err := net.Listen("tcp", s.host)
+	if err != nil {
+		return err
+	}
 	srv := &http.Server{
 		Addr:    s.host,
 		Handler: s.g,
 	}
+	s.srv = srv
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.report(err)
+		}
+	}()
+	log.Printf("Server is running on %s", s.host)
+	return nil
+}
+
+// abortStart 启动失败时回滚,关闭监听,逆序执行前n个OnStart对应的OnStop
+//
+// 在第一个OnStart之前注册的OnStop不与任何OnStart配对,对应的资源不是由Start创建的,回滚时不执行
+func (s *Server) abortStart(n int) {
+	if s.srv != nil {
+		_ = s.srv.Close()
+		s.srv = nil
+	}
+	s.closeAdmin()
+	if n == 0 {
+		return
+	}
+	from, to := s.stopMarks[0], len(s.onStop)
+	if n < len(s.stopMarks) {
+		to = s.stopMarks[n]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	for i := to - 1; i >= from; i-- {
+		if err := s.onStop[i](ctx); err != nil {
+			log.Println("Server OnStop:", err)
+		}
+	}
+}
+
+// Err 运行中HTTP服务出错时返回错误
+func (s *Server) Err() <-chan error {
+	return s.errc
+}
+
+// report 通过Err()通知运行中的错误,只保留第一个
+func (s *Server) report(err error) {
+	select {
+	case s.errc <- err:
+	default:
+	}
+}
 
+// startAdmin 在管理端口上提供指标
+func (s *Server) startAdmin() error {
+	if s.metrics == nil || s.metrics.opts.addr == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", s.metrics.opts.addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(s.metrics.opts.path, s.metrics.Handler())
+	admin := &http.Server{
+		Addr:    s.metrics.opts.addr,
+		Handler: mux,
+	}
+	s.admin = admin
 	go func() {
-		// 打印服务启动信息
-		log.Printf("Server is running on %s", s.host)
-		// 服务连接
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
+		if err := admin.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.report(err)
 		}
 	}()
-	// 等待中断信号以优雅地关闭服务器（设置 5 秒的超时时间）
-	quit := make(chan os.Signal)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	log.Printf("Metrics is running on %s%s", s.metrics.opts.addr, s.metrics.opts.path)
+	return nil
+}
+
+// closeAdmin 启动失败时关闭管理端口
+func (s *Server) closeAdmin() {
+	if s.admin != nil {
+		_ = s.admin.Close()
+		s.admin = nil
+	}
+}
+
+// Shutdown 优雅关闭
+//
+// 依次:标记为未就绪并注销服务,等待drain时间让负载均衡摘除当前实例,
+// 关闭HTTP服务并等待请求处理完成,按逆序执行OnStop;返回遇到的第一个错误
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv == nil || s.draining.Load() {
+		return nil
+	}
+	s.draining.Store(true)
 	log.Println("Shutdown Server ...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server Shutdown:", err)
+	var first error
+	record := func(name string, err error) {
+		if err == nil {
+			return
+		}
+		log.Println(name+":", err)
+		if first == nil {
+			first = err
+		}
+	}
+	// 先注销服务,避免关闭期间仍有新请求进来
+	record("Server Deregister", s.deregister(ctx))
+	if s.drain > 0 {
+		select {
+		case <-time.After(s.drain):
+		case <-ctx.Done():
+		}
+	}
+	record("Server Shutdown", s.srv.Shutdown(ctx))
+	if s.admin != nil {
+		record("Admin Shutdown", s.admin.Shutdown(ctx))
+	}
+	for i := len(s.onStop) - 1; i >= 0; i-- {
+		record("Server OnStop", s.onStop[i](ctx))
 	}
 	log.Println("Server exiting")
+	return first
+}
+
+// Stop 同Shutdown,用于app.Runnable
+func (s *Server) Stop(ctx context.Context) error {
+	return s.Shutdown(ctx)
+}
+
+// Run 启动Server并阻塞,收到SIGINT或SIGTERM后优雅关闭
+func (s *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := s.Start(ctx); err != nil {
+		return err
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-s.errc:
+	}
+	stop()
+
+	// 关闭超时包含drain时间
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.drain+s.shutdownTimeout)
+	defer cancel()
+	if serr := s.Shutdown(shutdownCtx); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// register 注册当前实例
+func (s *Server) register(ctx context.Context) error {
+	if s.registry == nil {
+		return nil
+	}
+	addr, err := registry.AdvertiseAddr(s.host)
+	if err != nil {
+		return err
+	}
+	s.instance = registry.Instance{
+		ID:   tools.GetUUID(),
+		Name: s.serviceName,
+		Addr: addr,
+	}
+	return s.registry.Register(ctx, s.instance)
+}
+
+// deregister 注销当前实例
+func (s *Server) deregister(ctx context.Context) error {
+	if s.registry == nil || s.instance.ID == "" {
+		return nil
+	}
+	return s.registry.Deregister(ctx, s.instance)
 }
 
 // getFreeHost 获取一个空闲的host,如果未指定host，动态获取有效服务端host
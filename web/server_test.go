@@ -0,0 +1,185 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServer_Lifecycle(t *testing.T) {
+	srv, err := NewServer(WithDrainPeriod(50 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	srv.OnStart(func(ctx context.Context) error {
+		order = append(order, "start")
+		return nil
+	})
+	srv.OnStop(func(ctx context.Context) error {
+		order = append(order, "stop redis")
+		return nil
+	})
+	srv.OnStop(func(ctx context.Context) error {
+		order = append(order, "stop queue")
+		return nil
+	})
+
+	if srv.Ready() {
+		t.Fatal("server should not be ready before start")
+	}
+	if err = srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Ready() {
+		t.Fatal("server should be ready after start")
+	}
+	resp, err := http.Get("http://127.0.0.1" + srv.Host() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Shutdown(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if srv.Ready() {
+		t.Fatal("server should not be ready while draining")
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start", "stop queue", "stop redis"}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v", order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v", order)
+		}
+	}
+}
+
+func TestServer_StartError(t *testing.T) {
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	boom := errors.New("boom")
+	var order []string
+	fail := true
+	// 第一个OnStart之前注册的OnStop不由Start回滚
+	srv.OnStop(func(ctx context.Context) error {
+		order = append(order, "close redis")
+		return nil
+	})
+	srv.OnStart(func(ctx context.Context) error {
+		order = append(order, "start db")
+		return nil
+	})
+	srv.OnStop(func(ctx context.Context) error {
+		order = append(order, "stop db")
+		return nil
+	})
+	srv.OnStart(func(ctx context.Context) error {
+		if fail {
+			return boom
+		}
+		order = append(order, "start worker")
+		return nil
+	})
+	srv.OnStop(func(ctx context.Context) error {
+		order = append(order, "stop worker")
+		return nil
+	})
+	want := func(names ...string) {
+		t.Helper()
+		if strings.Join(order, ",") != strings.Join(names, ",") {
+			t.Fatalf("order = %v, want %v", order, names)
+		}
+	}
+
+	// OnStart失败时只回滚已完成的OnStart对应的OnStop
+	if err = srv.Start(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("start = %v", err)
+	}
+	want("start db", "stop db")
+	if srv.Ready() {
+		t.Fatal("server should not be ready after failed start")
+	}
+
+	// 监听失败时关闭已启动的部分,之后可以重试
+	ln, err := net.Listen("tcp", "127.0.0.1"+srv.Host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail = false
+	order = nil
+	if err = srv.Start(context.Background()); err == nil {
+		t.Fatal("start on occupied port should fail")
+	}
+	want("start db", "start worker", "stop worker", "stop db")
+	ln.Close()
+
+	order = nil
+	if err = srv.Start(context.Background()); err != nil {
+		t.Fatalf("retry start = %v", err)
+	}
+	if !srv.Ready() {
+		t.Fatal("server should be ready after retry")
+	}
+	if err = srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 关闭时执行所有OnStop
+	want("start db", "start worker", "stop worker", "stop db", "close redis")
+}
+
+func TestServer_RunSignal(t *testing.T) {
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan struct{})
+	srv.OnStop(func(ctx context.Context) error {
+		close(stopped)
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run()
+	}()
+	for deadline := time.Now().Add(3 * time.Second); !srv.Ready(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("server not ready")
+		}
+	}
+	if err = syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("run should return after SIGTERM")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("OnStop not called")
+	}
+	if srv.Ready() {
+		t.Fatal("server should not be ready after shutdown")
+	}
+}
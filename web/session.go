@@ -0,0 +1,515 @@
+package web
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrNoSessionManager 未安装会话中间件
+var ErrNoSessionManager = errors.New("web: session manager is not installed")
+
+// gin.Context中保存会话的key
+const (
+	sessionManagerKey = "gokit/session_manager"
+	sessionKey        = "gokit/session"
+)
+
+// SessionData 会话数据
+type SessionData struct {
+	UserID  string                     `json:"user_id,omitempty"`
+	Values  map[string]json.RawMessage `json:"values,omitempty"`
+	Flashes []string                   `json:"flashes,omitempty"`
+}
+
+// SessionStore 会话存储
+type SessionStore interface {
+	// Load 加载会话,不存在或已过期时返回nil
+	Load(ctx context.Context, id string) (*SessionData, error)
+	// Save 保存会话并设置过期时间
+	Save(ctx context.Context, id string, data *SessionData, ttl time.Duration) error
+	// Touch 延长会话的过期时间
+	Touch(ctx context.Context, id string, ttl time.Duration) error
+	// Delete 删除会话
+	Delete(ctx context.Context, id string) error
+	// DeleteUser 删除用户的所有会话
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+type sessionOptions struct {
+	cookie   string
+	ttl      time.Duration
+	path     string
+	domain   string
+	secure   bool
+	sameSite http.SameSite
+	aead     cipher.AEAD
+}
+
+// SessionOption 会话选项
+type SessionOption func(*sessionOptions) error
+
+// WithSessionCookie 设置cookie名称,默认 gokit_session
+func WithSessionCookie(name string) SessionOption {
+	return func(o *sessionOptions) error {
+		o.cookie = name
+		return nil
+	}
+}
+
+// WithSessionTTL 设置会话的空闲过期时间,默认24小时
+//
+// 距上次续期超过四分之一有效期后,访问时重新设置cookie并延长存储中的过期时间
+func WithSessionTTL(ttl time.Duration) SessionOption {
+	return func(o *sessionOptions) error {
+		o.ttl = ttl
+		return nil
+	}
+}
+
+// WithSessionCookieScope 设置cookie的path与domain,默认 / 与当前域名
+func WithSessionCookieScope(path, domain string) SessionOption {
+	return func(o *sessionOptions) error {
+		o.path, o.domain = path, domain
+		return nil
+	}
+}
+
+// WithSessionSecure 设置cookie是否只通过HTTPS发送,默认是
+func WithSessionSecure(secure bool) SessionOption {
+	return func(o *sessionOptions) error {
+		o.secure = secure
+		return nil
+	}
+}
+
+// WithSessionSameSite 设置cookie的SameSite,默认Lax
+func WithSessionSameSite(sameSite http.SameSite) SessionOption {
+	return func(o *sessionOptions) error {
+		o.sameSite = sameSite
+		return nil
+	}
+}
+
+// WithSessionEncryption 加密cookie中的会话ID,key为16、24或32字节的AES密钥
+func WithSessionEncryption(key []byte) SessionOption {
+	return func(o *sessionOptions) error {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		o.aead, err = cipher.NewGCM(block)
+		return err
+	}
+}
+
+// SessionManager 会话管理,cookie中只保存签名后的会话ID,数据保存在SessionStore中
+//
+// example:
+//
+//	sm, err := web.NewSessionManager(web.NewRedisSessionStore(cli, ""), []byte(secret))
+//	srv, err := web.NewServer(web.WithSessions(sm), web.WithRoutes(Admin{}))
+//
+//	func (a Admin) Login(ctx *web.Context) any {
+//	  s := ctx.Session()
+//	  s.Regenerate()
+//	  s.SetUser(user.ID)
+//	  s.AddFlash("登录成功")
+//	  return ctx.BizData(nil)
+//	}
+type SessionManager struct {
+	store  SessionStore
+	secret []byte
+	opts   sessionOptions
+	now    func() time.Time
+}
+
+// NewSessionManager 创建会话管理,secret用于签名会话ID
+func NewSessionManager(store SessionStore, secret []byte, opts ...SessionOption) (*SessionManager, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("web: session secret is empty")
+	}
+	o := sessionOptions{
+		cookie:   "gokit_session",
+		ttl:      24 * time.Hour,
+		path:     "/",
+		secure:   true,
+		sameSite: http.SameSiteLaxMode,
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	return &SessionManager{store: store, secret: secret, opts: o, now: time.Now}, nil
+}
+
+// WithSessions 设置会话管理,所有路由可通过Context.Session()使用会话
+func WithSessions(m *SessionManager) ServerOption {
+	return func(s *Server) {
+		s.sessions = m
+	}
+}
+
+// Middleware 会话中间件,在写出响应前保存会话,请求结束时保存之后的修改
+func (m *SessionManager) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(sessionManagerKey, m)
+		id, issuedAt, ok := m.readCookie(c)
+		refresh := ok && m.now().Sub(issuedAt) >= m.opts.ttl/4
+		if refresh {
+			// 滑动过期,距上次续期超过四分之一有效期时重新设置cookie
+			m.writeCookie(c, id)
+		}
+		w := &sessionWriter{ResponseWriter: c.Writer, m: m, c: c, id: id, refresh: refresh}
+		c.Writer = w
+		c.Next()
+		w.commit()
+	}
+}
+
+// sessionWriter 在首次写出响应前保存会话,避免客户端收到响应后立即发起的请求读不到会话
+type sessionWriter struct {
+	gin.ResponseWriter
+	m         *SessionManager
+	c         *gin.Context
+	id        string
+	refresh   bool // 需要延长存储中的过期时间
+	committed bool // 已写出响应
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	w.beforeWrite()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) WriteHeaderNow() {
+	w.beforeWrite()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.beforeWrite()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sessionWriter) WriteString(s string) (int, error) {
+	w.beforeWrite()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *sessionWriter) Flush() {
+	w.beforeWrite()
+	w.ResponseWriter.Flush()
+}
+
+func (w *sessionWriter) beforeWrite() {
+	if !w.committed {
+		w.committed = true
+		w.commit()
+	}
+}
+
+// commit 保存会话,没有修改时只在需要续期时延长过期时间
+func (w *sessionWriter) commit() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var err error
+	if v, loaded := w.c.Get(sessionKey); loaded {
+		err = w.m.save(ctx, v.(*Session), w.refresh)
+	} else if w.refresh {
+		err = w.m.store.Touch(ctx, w.id, w.m.opts.ttl)
+	}
+	w.refresh = false
+	if err != nil {
+		log.Println("Session Save:", err)
+	}
+}
+
+// RevokeUser 删除用户的所有会话,如修改密码后
+func (m *SessionManager) RevokeUser(ctx context.Context, userID string) error {
+	return m.store.DeleteUser(ctx, userID)
+}
+
+// save 保存请求中使用过的会话,保存后清除修改标记,同一请求中可以多次调用
+func (m *SessionManager) save(ctx context.Context, s *Session, refresh bool) error {
+	if s.oldID != "" {
+		if err := m.store.Delete(ctx, s.oldID); err != nil {
+			return err
+		}
+		s.oldID = ""
+	}
+	var err error
+	switch {
+	case s.destroyed:
+		if !s.deleted {
+			err = m.store.Delete(ctx, s.id)
+			s.deleted = err == nil
+		}
+	case s.dirty:
+		err = m.store.Save(ctx, s.id, s.data, m.opts.ttl)
+	case !s.isNew && refresh:
+		err = m.store.Touch(ctx, s.id, m.opts.ttl)
+	}
+	if err == nil {
+		s.dirty = false
+	}
+	return err
+}
+
+// load 加载请求的会话,不存在时创建新会话
+func (m *SessionManager) load(c *gin.Context) *Session {
+	s := &Session{m: m, g: c, data: &SessionData{}}
+	if id, _, ok := m.readCookie(c); ok {
+		data, err := m.store.Load(c.Request.Context(), id)
+		switch {
+		case err != nil:
+			s.err = err
+		case data != nil:
+			s.id, s.data, s.issued = id, data, true
+		}
+	}
+	if s.id == "" {
+		s.id, s.isNew = newSessionID(), true
+	}
+	if s.data.Values == nil {
+		s.data.Values = make(map[string]json.RawMessage)
+	}
+	return s
+}
+
+// readCookie 读取并校验cookie中的会话ID与cookie的签发时间
+func (m *SessionManager) readCookie(c *gin.Context) (string, time.Time, bool) {
+	raw, err := c.Cookie(m.opts.cookie)
+	if err != nil || raw == "" {
+		return "", time.Time{}, false
+	}
+	payload, sig, ok := strings.Cut(raw, ".")
+	if !ok {
+		return "", time.Time{}, false
+	}
+	want := m.sign(payload)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return "", time.Time{}, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	if m.opts.aead != nil {
+		n := m.opts.aead.NonceSize()
+		if len(b) < n {
+			return "", time.Time{}, false
+		}
+		if b, err = m.opts.aead.Open(nil, b[:n], b[n:], []byte(m.opts.cookie)); err != nil {
+			return "", time.Time{}, false
+		}
+	}
+	id, ts, ok := strings.Cut(string(b), "|")
+	if !ok {
+		return "", time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return id, time.Unix(sec, 0), true
+}
+
+// writeCookie 签名并写入会话ID,同时记录签发时间用于判断是否需要续期
+func (m *SessionManager) writeCookie(c *gin.Context, id string) {
+	b := []byte(id + "|" + strconv.FormatInt(m.now().Unix(), 10))
+	if m.opts.aead != nil {
+		nonce := make([]byte, m.opts.aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return
+		}
+		b = m.opts.aead.Seal(nonce, nonce, b, []byte(m.opts.cookie))
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	m.setCookie(c, payload+"."+m.sign(payload), int(m.opts.ttl/time.Second))
+}
+
+// clearCookie 删除cookie
+func (m *SessionManager) clearCookie(c *gin.Context) {
+	m.setCookie(c, "", -1)
+}
+
+func (m *SessionManager) setCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     m.opts.cookie,
+		Value:    value,
+		Path:     m.opts.path,
+		Domain:   m.opts.domain,
+		MaxAge:   maxAge,
+		Secure:   m.opts.secure,
+		HttpOnly: true,
+		SameSite: m.opts.sameSite,
+	})
+}
+
+func (m *SessionManager) sign(payload string) string {
+	h := hmac.New(sha256.New, m.secret)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	_, _ = io.ReadFull(rand.Reader, b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Session 会话,修改会在写出响应前保存,写出响应后的修改在请求结束时保存
+//
+// 新会话在首次修改时写入cookie,Regenerate与Destroy同样需要写cookie,都应在写出响应之前调用
+type Session struct {
+	m    *SessionManager
+	g    *gin.Context
+	id   string
+	data *SessionData
+
+	isNew     bool   // 新创建的会话
+	issued    bool   // cookie中已是当前ID
+	dirty     bool   // 数据已修改
+	destroyed bool   // 已销毁
+	deleted   bool   // 已从存储中删除
+	oldID     string // Regenerate前的ID,保存时删除
+	err       error
+}
+
+// Session 当前请求的会话,需要通过WithSessions安装会话中间件
+func (c *Context) Session() *Session {
+	if v, ok := c.g.Get(sessionKey); ok {
+		return v.(*Session)
+	}
+	v, ok := c.g.Get(sessionManagerKey)
+	if !ok {
+		// 未安装中间件时返回不会保存的会话
+		return &Session{g: c.g, data: &SessionData{Values: map[string]json.RawMessage{}}, err: ErrNoSessionManager}
+	}
+	s := v.(*SessionManager).load(c.g)
+	c.g.Set(sessionKey, s)
+	return s
+}
+
+// Err 加载会话时的错误,出错时返回的是一个新会话
+func (s *Session) Err() error {
+	return s.err
+}
+
+// ID 会话ID
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IsNew 是否是本次请求新创建的会话
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+// Get 获取值并解码到out,不存在或解码失败时返回false
+func (s *Session) Get(key string, out any) bool {
+	raw, ok := s.data.Values[key]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(raw, out) == nil
+}
+
+// GetString 获取字符串值
+func (s *Session) GetString(key string) string {
+	var v string
+	s.Get(key, &v)
+	return v
+}
+
+// Set 设置值,值按JSON编码保存
+func (s *Session) Set(key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.data.Values[key] = b
+	s.touch()
+	return nil
+}
+
+// Delete 删除值
+func (s *Session) Delete(key string) {
+	if _, ok := s.data.Values[key]; ok {
+		delete(s.data.Values, key)
+		s.touch()
+	}
+}
+
+// UserID 会话所属的用户
+func (s *Session) UserID() string {
+	return s.data.UserID
+}
+
+// SetUser 设置会话所属的用户,用于SessionManager.RevokeUser
+func (s *Session) SetUser(userID string) {
+	s.data.UserID = userID
+	s.touch()
+}
+
+// AddFlash 添加一次性消息,在下次读取Flashes后删除
+func (s *Session) AddFlash(msg string) {
+	s.data.Flashes = append(s.data.Flashes, msg)
+	s.touch()
+}
+
+// Flashes 读取并删除一次性消息
+func (s *Session) Flashes() []string {
+	flashes := s.data.Flashes
+	if len(flashes) > 0 {
+		s.data.Flashes = nil
+		s.touch()
+	}
+	return flashes
+}
+
+// Regenerate 更换会话ID并保留数据,登录等权限变化后调用以防止会话固定攻击
+func (s *Session) Regenerate() {
+	if s.m == nil {
+		return
+	}
+	if !s.isNew && s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id, s.issued = newSessionID(), false
+	s.touch()
+}
+
+// Destroy 销毁会话并删除cookie,如退出登录
+func (s *Session) Destroy() {
+	s.destroyed = true
+	s.data = &SessionData{Values: map[string]json.RawMessage{}}
+	if s.m != nil {
+		s.m.clearCookie(s.g)
+	}
+}
+
+// touch 标记已修改,首次修改时写入cookie
+func (s *Session) touch() {
+	s.dirty = true
+	if s.m != nil && !s.issued && !s.destroyed {
+		s.m.writeCookie(s.g, s.id)
+		s.issued = true
+	}
+}
@@ -0,0 +1,218 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/cloudneedle/gokit/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var (
+	_ SessionStore = (*RedisSessionStore)(nil)
+	_ SessionStore = (*MemorySessionStore)(nil)
+)
+
+// RedisSessionStore 基于Redis的会话存储
+//
+// 会话保存在 <prefix><id>,用户的会话ID集合保存在 <prefix>user:<user_id>
+type RedisSessionStore struct {
+	c      *redis.Client
+	prefix string
+}
+
+// NewRedisSessionStore 创建Redis会话存储,prefix为空时使用 session:
+func NewRedisSessionStore(c *redis.Client, prefix string) *RedisSessionStore {
+	if prefix == "" {
+		prefix = "session:"
+	}
+	return &RedisSessionStore{c: c, prefix: prefix}
+}
+
+func (r *RedisSessionStore) key(id string) string {
+	return r.prefix + id
+}
+
+func (r *RedisSessionStore) userKey(userID string) string {
+	return r.prefix + "user:" + userID
+}
+
+func (r *RedisSessionStore) Load(ctx context.Context, id string) (*SessionData, error) {
+	b, err := r.c.Get(ctx, r.key(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data SessionData
+	if err = json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// extendScript 延长key的过期时间,已有的过期时间更长时保持不变,在pipeline中使用Eval执行
+//
+// KEYS[1] key ARGV[1] 过期时间(毫秒)
+var extendScript = goredis.NewScript(`
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < tonumber(ARGV[1]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return ttl
+`)
+
+func (r *RedisSessionStore) Save(ctx context.Context, id string, data *SessionData, ttl time.Duration) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	pipe := r.c.TxPipeline()
+	pipe.Set(ctx, r.key(id), b, ttl)
+	if data.UserID != "" {
+		// 用户的会话集合不早于其中任何一个会话过期,集合中已过期的ID在撤销时一并删除
+		pipe.SAdd(ctx, r.userKey(data.UserID), id)
+		extendScript.Eval(ctx, pipe, []string{r.userKey(data.UserID)}, ttl.Milliseconds())
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisSessionStore) Touch(ctx context.Context, id string, ttl time.Duration) error {
+	data, err := r.Load(ctx, id)
+	if err != nil || data == nil {
+		return err
+	}
+	pipe := r.c.Pipeline()
+	pipe.Expire(ctx, r.key(id), ttl)
+	if data.UserID != "" {
+		// 同时延长用户的会话集合,否则集合先于会话过期,撤销时找不到该会话
+		extendScript.Eval(ctx, pipe, []string{r.userKey(data.UserID)}, ttl.Milliseconds())
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisSessionStore) Delete(ctx context.Context, id string) error {
+	return r.c.Del(ctx, r.key(id)).Err()
+}
+
+func (r *RedisSessionStore) DeleteUser(ctx context.Context, userID string) error {
+	ids, err := r.c.SMembers(ctx, r.userKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(ids)+1)
+	for _, id := range ids {
+		keys = append(keys, r.key(id))
+	}
+	keys = append(keys, r.userKey(userID))
+	// 逐个删除,集群模式下这些key可能不在同一个slot
+	pipe := r.c.Pipeline()
+	for _, k := range keys {
+		pipe.Del(ctx, k)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// MemorySessionStore 进程内的会话存储,用于测试或单实例部署
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+	users    map[string]map[string]bool
+}
+
+type memorySession struct {
+	data     []byte
+	userID   string
+	expireAt time.Time
+}
+
+// NewMemorySessionStore 创建进程内会话存储
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]memorySession),
+		users:    make(map[string]map[string]bool),
+	}
+}
+
+func (m *MemorySessionStore) Load(_ context.Context, id string) (*SessionData, error) {
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	if ok && time.Now().After(s.expireAt) {
+		m.remove(id)
+		ok = false
+	}
+	m.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	var data SessionData
+	if err := json.Unmarshal(s.data, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (m *MemorySessionStore) Save(_ context.Context, id string, data *SessionData, ttl time.Duration) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	m.sessions[id] = memorySession{data: b, userID: data.UserID, expireAt: time.Now().Add(ttl)}
+	if data.UserID != "" {
+		if m.users[data.UserID] == nil {
+			m.users[data.UserID] = make(map[string]bool)
+		}
+		m.users[data.UserID][id] = true
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) Touch(_ context.Context, id string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[id]; ok {
+		s.expireAt = time.Now().Add(ttl)
+		m.sessions[id] = s
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	return nil
+}
+
+func (m *MemorySessionStore) DeleteUser(_ context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.users[userID] {
+		delete(m.sessions, id)
+	}
+	delete(m.users, userID)
+	return nil
+}
+
+func (m *MemorySessionStore) remove(id string) {
+	s, ok := m.sessions[id]
+	if !ok {
+		return
+	}
+	delete(m.sessions, id)
+	if ids := m.users[s.userID]; ids != nil {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(m.users, s.userID)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cloudneedle/gokit/redis"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSession(t *testing.T) {
+	store := NewMemorySessionStore()
+	sm, err := NewSessionManager(store, []byte("secret"), WithSessionEncryption(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := NewServer(WithSessions(sm), WithRoutes(sessionRoutes{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		srv.GIN().ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/login", nil)
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("login should set session cookie")
+	}
+	if w = do("/me", cookies); w.Body.String() != `{"flashes":["welcome"],"user":"u1"}` {
+		t.Fatalf("me = %s", w.Body.String())
+	}
+	if w = do("/me", cookies); w.Body.String() != `{"flashes":null,"user":"u1"}` {
+		t.Fatalf("flashes should be consumed, me = %s", w.Body.String())
+	}
+
+	// 篡改cookie
+	bad := []*http.Cookie{{Name: cookies[0].Name, Value: cookies[0].Value + "x"}}
+	if w = do("/me", bad); w.Body.String() != `{"flashes":null,"user":""}` {
+		t.Fatalf("tampered cookie should be rejected, me = %s", w.Body.String())
+	}
+
+	if err = sm.RevokeUser(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if w = do("/me", cookies); w.Body.String() != `{"flashes":null,"user":""}` {
+		t.Fatalf("revoked session should be gone, me = %s", w.Body.String())
+	}
+}
+
+func TestSession_RedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(redis.Options{Addr: mr.Addr()})
+	defer cli.Close()
+	sm, err := NewSessionManager(NewRedisSessionStore(cli, ""), []byte("secret"), WithSessionTTL(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	sm.now = func() time.Time { return now }
+	forward := func(d time.Duration) {
+		now = now.Add(d)
+		mr.FastForward(d)
+	}
+	srv, err := NewServer(WithSessions(sm), WithRoutes(sessionRoutes{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(path string, cookies []*http.Cookie) string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		srv.GIN().ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	w := httptest.NewRecorder()
+	srv.GIN().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	cookies := w.Result().Cookies()
+	if body := do("/me", cookies); body != `{"flashes":["welcome"],"user":"u1"}` {
+		t.Fatalf("me = %s", body)
+	}
+
+	// 滑动过期后用户的会话集合仍然存在
+	forward(40 * time.Minute)
+	if body := do("/me", cookies); body != `{"flashes":null,"user":"u1"}` {
+		t.Fatalf("me = %s", body)
+	}
+	forward(40 * time.Minute)
+	if body := do("/me", cookies); body != `{"flashes":null,"user":"u1"}` {
+		t.Fatalf("slid session should be alive, me = %s", body)
+	}
+	if ttl := mr.TTL("session:user:u1"); ttl < 59*time.Minute {
+		t.Fatalf("user index ttl = %s", ttl)
+	}
+
+	if err = sm.RevokeUser(context.Background(), "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if body := do("/me", cookies); body != `{"flashes":null,"user":""}` {
+		t.Fatalf("revoked session should be gone, me = %s", body)
+	}
+}
+
+func TestSession_SaveBeforeWrite(t *testing.T) {
+	store := &countingSessionStore{SessionStore: NewMemorySessionStore()}
+	sm, err := NewSessionManager(store, []byte("secret"), WithSessionTTL(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	sm.now = func() time.Time { return now }
+	saved := make(chan bool, 1)
+	srv, err := NewServer(WithSessions(sm), WithRoutes(sessionRoutes{}), WithRoutes(redirectRoutes{store, saved}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		srv.GIN().ServeHTTP(w, req)
+		return w
+	}
+
+	cookies := do("/redirect", nil).Result().Cookies()
+	if !<-saved {
+		t.Fatal("session should be saved before the response is written")
+	}
+
+	// 未修改且未到续期时间,不重新发送cookie也不续期
+	store.touches = 0
+	if w := do("/me", cookies); len(w.Result().Cookies()) != 0 || store.touches != 0 {
+		t.Fatalf("cookies = %v, touches = %d", w.Result().Cookies(), store.touches)
+	}
+	now = now.Add(20 * time.Minute)
+	if w := do("/me", cookies); len(w.Result().Cookies()) != 1 || store.touches != 1 {
+		t.Fatalf("cookies = %v, touches = %d", w.Result().Cookies(), store.touches)
+	}
+}
+
+// countingSessionStore 记录Touch的调用次数
+type countingSessionStore struct {
+	SessionStore
+	touches int
+}
+
+func (s *countingSessionStore) Touch(ctx context.Context, id string, ttl time.Duration) error {
+	s.touches++
+	return s.SessionStore.Touch(ctx, id, ttl)
+}
+
+// redirectRoutes 登录后重定向,记录写出响应时会话是否已保存
+type redirectRoutes struct {
+	store SessionStore
+	saved chan bool
+}
+
+func (r redirectRoutes) Routes(ctx *RouteContext) {
+	ctx.GET("/redirect", func(g *gin.Context) {
+		s := (&Context{g: g}).Session()
+		s.SetUser("u2")
+		g.Redirect(http.StatusFound, "/me")
+		data, _ := r.store.Load(context.Background(), s.ID())
+		r.saved <- data != nil && data.UserID == "u2"
+	})
+}
+
+type sessionRoutes struct{}
+
+func (sessionRoutes) Routes(ctx *RouteContext) {
+	ctx.GET("/login", ctx.Handle(func(c *Context) any {
+		s := c.Session()
+		s.Regenerate()
+		s.SetUser("u1")
+		s.AddFlash("welcome")
+		return c.Data(nil)
+	}))
+	ctx.GET("/me", ctx.Handle(func(c *Context) any {
+		s := c.Session()
+		return map[string]any{"user": s.UserID(), "flashes": s.Flashes()}
+	}))
+}